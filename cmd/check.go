@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"github.com/katzien/crawler/pkg"
+	"strconv"
+)
+
+// runCheck crawls a website, or loads a saved crawl, and lists the links pointing to pages which couldn't be
+// fetched or returned an error status, e.g.:
+//
+//	crawler check -url https://example.com -depth 0
+//	crawler check crawl.json
+//
+// It exits with ExitFindings if any broken links are found, or ExitPartial if the crawl timed out.
+func runCheck(args []string) (int, error) {
+	opts, fs, err := parseFlags("check", args, false)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return ExitUsage, fmt.Errorf("check expects at most one saved crawl, got %d", fs.NArg())
+	}
+
+	result, err := crawlOrLoad(opts, fs)
+	if err != nil {
+		return ExitError, err
+	}
+
+	broken := crawler.BrokenLinks(result.sitemap)
+
+	fmt.Printf("Checked %d pages, found %d broken link(s).\n", len(result.sitemap.Pages()), len(broken))
+
+	for _, l := range broken {
+		target, _ := result.sitemap.Node(crawler.CanonicalURL(l.Target))
+
+		status := strconv.Itoa(target.Status)
+		if target.Error != "" {
+			status = target.Error
+		}
+
+		fmt.Printf("%s -> %s (%s)\n", l.Source, l.Target, status)
+	}
+
+	if len(broken) > 0 {
+		return ExitFindings, nil
+	}
+
+	if result.partial {
+		return ExitPartial, nil
+	}
+
+	return ExitSuccess, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"github.com/katzien/crawler/pkg"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultCompareFormat is the default output format of the compare command if no format flag has been specified.
+// Supported formats are "text" and "json".
+const DefaultCompareFormat = "text"
+
+// runCompare crawls two deployments of the same site in parallel and compares them, mapping paths between them, e.g.:
+//
+//	crawler compare -depth 0 -map /en=/ https://staging.example.com https://example.com
+//	crawler compare staging.json production.json
+//
+// Either side can be a crawl saved with the save flag (or a run ID if the store flag is set) rather than a URL.
+// It exits with ExitFindings if the sides differ, or ExitPartial if either crawl timed out.
+func runCompare(args []string) (int, error) {
+	opts, fs, err := parseFlags("compare", args, false)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return ExitUsage, fmt.Errorf("compare expects exactly two base URLs or saved crawls, got %d", fs.NArg())
+	}
+
+	if opts.cmpFormat != "text" && opts.cmpFormat != "json" {
+		return ExitUsage, fmt.Errorf("unsupported format %q: must be one of text or json", opts.cmpFormat)
+	}
+
+	if opts.save != "" || opts.previous != "" || opts.metricsAddr != "" {
+		return ExitUsage, fmt.Errorf("save, previous and metrics-addr aren't supported by compare, as both sides are crawled at the same time")
+	}
+
+	mappings, err := pathMappings(opts.mappings)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	// The live progress lines of the two crawls would overwrite each other.
+	opts.progress = 0
+
+	var wg sync.WaitGroup
+	results := make([]crawlResult, 2)
+	errs := make([]error, 2)
+
+	for i, arg := range fs.Args() {
+		wg.Add(1)
+		go func(i int, arg string) {
+			defer wg.Done()
+			results[i], errs[i] = crawlOrLoadSide(opts, arg)
+		}(i, arg)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return ExitError, err
+		}
+	}
+
+	left := crawler.Snapshot{Start: results[0].start.String(), Sitemap: results[0].sitemap}
+	right := crawler.Snapshot{Start: results[1].start.String(), Sitemap: results[1].sitemap}
+
+	c, err := crawler.Compare(left, right, mappings)
+	if err != nil {
+		return ExitError, err
+	}
+
+	switch opts.cmpFormat {
+	case "json":
+		js, err := crawler.ComparisonJSON(c)
+		if err != nil {
+			return ExitError, err
+		}
+		fmt.Println(js)
+	default:
+		text, err := crawler.ComparisonText(c)
+		if err != nil {
+			return ExitError, err
+		}
+		fmt.Println(text)
+	}
+
+	if !c.Empty() {
+		return ExitFindings, nil
+	}
+
+	if results[0].partial || results[1].partial {
+		return ExitPartial, nil
+	}
+
+	return ExitSuccess, nil
+}
+
+// crawlOrLoadSide crawls the given base URL, or loads the given saved crawl if it isn't an http(s) URL.
+func crawlOrLoadSide(opts options, arg string) (crawlResult, error) {
+	u, err := url.Parse(arg)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		opts.startURL = arg
+		return crawl(opts)
+	}
+
+	return loadResult(opts.store, arg)
+}
+
+// pathMappings parses the path mappings given as from=to with the map flag.
+func pathMappings(values hostValues) ([]crawler.PathMapping, error) {
+	var mappings []crawler.PathMapping
+
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "/") || !strings.HasPrefix(parts[1], "/") {
+			return nil, fmt.Errorf("path mapping %q must be given as from=to, with both paths starting with /", v)
+		}
+
+		mappings = append(mappings, crawler.PathMapping{From: parts[0], To: parts[1]})
+	}
+
+	return mappings, nil
+}
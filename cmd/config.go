@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileConfig is the layout of the YAML config file given with the config flag, e.g.:
+//
+//	url: https://example.com
+//	depth: 3
+//	timeout: 5m
+//	metrics-addr: :9090
+//	previous: crawl.json
+//	fetch:
+//	  timeout: 10s
+//	  retries: 3
+//	  user-agent: docs-bot/1.0
+//	  from: web@example.com
+//	  resolve:
+//	    example.com: 10.0.0.5
+//	  cookies: cookies.txt
+//	  auth:
+//	    - host: staging.example.com
+//	      username: admin
+//	      password: ${STAGING_PASSWORD}
+//	  login:
+//	    page: https://example.com/login
+//	    form:
+//	      username: admin
+//	      password: ${PASSWORD}
+//	output:
+//	  format: tree
+//	  annotate: true
+//
+// Fields are pointers so that only the values present in the file override the defaults.
+// Environment variables in credentials, headers and login fields are expanded, so that secrets don't need to be stored in the file.
+type fileConfig struct {
+	URL         *string        `yaml:"url"`
+	Depth       *int           `yaml:"depth"`
+	Timeout     *time.Duration `yaml:"timeout"`
+	MetricsAddr *string        `yaml:"metrics-addr"`
+	Previous    *string        `yaml:"previous"`
+	Fetch       struct {
+		Timeout        *time.Duration    `yaml:"timeout"`
+		MaxBodySize    *int64            `yaml:"max-body-size"`
+		KeepAlive      *time.Duration    `yaml:"keep-alive"`
+		MaxIdle        *int              `yaml:"max-idle-per-host"`
+		DisableHTTP2   *bool             `yaml:"disable-http2"`
+		DialTimeout    *time.Duration    `yaml:"dial-timeout"`
+		TLSTimeout     *time.Duration    `yaml:"tls-handshake-timeout"`
+		Retries        *int              `yaml:"retries"`
+		RetryBackoff   *time.Duration    `yaml:"retry-backoff"`
+		UserAgent      *string           `yaml:"user-agent"`
+		AcceptLanguage *string           `yaml:"accept-language"`
+		From           *string           `yaml:"from"`
+		Resolve        map[string]string `yaml:"resolve"`
+		Proxy          *string           `yaml:"proxy"`
+		CAFile         *string           `yaml:"ca-file"`
+		ClientCert     *string           `yaml:"client-cert"`
+		ClientKey      *string           `yaml:"client-key"`
+		Insecure       *bool             `yaml:"insecure-skip-verify"`
+		Cookies        *string           `yaml:"cookies"`
+		Cache          *string           `yaml:"cache"`
+		CacheTTL       *time.Duration    `yaml:"cache-ttl"`
+		Offline        *bool             `yaml:"offline"`
+		Auth           []authConfig      `yaml:"auth"`
+		Login          *loginConfig      `yaml:"login"`
+	} `yaml:"fetch"`
+	Output struct {
+		Format       *string        `yaml:"format"`
+		MermaidDepth *int           `yaml:"mermaid-depth"`
+		MermaidNodes *int           `yaml:"mermaid-nodes"`
+		Annotate     *bool          `yaml:"annotate"`
+		Save         *string        `yaml:"save"`
+		Store        *string        `yaml:"store"`
+		Progress     *time.Duration `yaml:"progress"`
+	} `yaml:"output"`
+}
+
+// authConfig holds the credentials sent to a single host.
+type authConfig struct {
+	Host        string            `yaml:"host"`
+	Username    string            `yaml:"username"`
+	Password    string            `yaml:"password"`
+	BearerToken string            `yaml:"bearer-token"`
+	Headers     map[string]string `yaml:"headers"`
+}
+
+// loginConfig describes how to log in before crawling.
+type loginConfig struct {
+	Page        string            `yaml:"page"`
+	URL         string            `yaml:"url"`
+	Form        map[string]string `yaml:"form"`
+	Body        string            `yaml:"body"`
+	ContentType string            `yaml:"content-type"`
+}
+
+// configErrors holds all the problems found in a config file, one per line.
+type configErrors []string
+
+func (e configErrors) Error() string {
+	return strings.Join(e, "\n")
+}
+
+// runConfig validates a config file without crawling anything, e.g.:
+//
+//	crawler config validate crawl.yaml
+//
+// It exits with ExitFindings if the config file has errors.
+func runConfig(args []string) (int, error) {
+	fs := newFlagSet("config", "validate <file>", "Checks the given config file for errors, reporting the line number of every error found.")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if fs.NArg() != 2 || fs.Arg(0) != "validate" {
+		fs.Usage()
+		return ExitUsage, errors.New("config expects the validate command and a config file")
+	}
+
+	_, err = loadConfig(fs.Arg(1))
+	if errs, ok := err.(configErrors); ok {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		return ExitFindings, fmt.Errorf("found %d error(s) in %s", len(errs), fs.Arg(1))
+	}
+	if err != nil {
+		return ExitError, err
+	}
+
+	fmt.Printf("%s is valid.\n", fs.Arg(1))
+
+	return ExitSuccess, nil
+}
+
+// loadConfig reads and validates the given config file. All the errors found are returned at once,
+// prefixed with the file name and line number.
+func loadConfig(file string) (fileConfig, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fileConfig{}, fmt.Errorf("error reading the config file: %s", err.Error())
+	}
+
+	cfg, errs := parseConfig(b)
+	if len(errs) > 0 {
+		for i := range errs {
+			errs[i] = file + ":" + errs[i]
+		}
+		return cfg, errs
+	}
+
+	return cfg, nil
+}
+
+// parseConfig decodes and validates the given config, returning every error found as "line: message".
+func parseConfig(b []byte) (fileConfig, configErrors) {
+	var cfg fileConfig
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+
+	var errs configErrors
+
+	// Type errors (e.g. unknown fields or values of the wrong type) don't stop the rest of the file from being decoded,
+	// so the values which were decoded are validated too.
+	err := dec.Decode(&cfg)
+	if err == io.EOF {
+		return cfg, nil
+	}
+
+	// Values which couldn't be decoded are left set to their zero value, so they aren't validated: the lines they're on
+	// are kept to skip them.
+	undecoded := make(map[int]bool)
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, e := range typeErr.Errors {
+			e = yamlErrorLine(e)
+			if strings.Contains(e, "cannot unmarshal") {
+				undecoded[errorLine(e)] = true
+			}
+			errs = append(errs, e)
+		}
+	} else if err != nil {
+		return cfg, configErrors{yamlErrorLine(strings.TrimPrefix(err.Error(), "yaml: "))}
+	}
+
+	var root yaml.Node
+	err = yaml.Unmarshal(b, &root)
+	if err != nil {
+		return cfg, configErrors{yamlErrorLine(strings.TrimPrefix(err.Error(), "yaml: "))}
+	}
+
+	invalid := func(msg string, path ...string) {
+		line := configLine(&root, path...)
+		if !undecoded[line] {
+			errs = append(errs, fmt.Sprintf("%d: %s: %s", line, strings.Join(path, "."), msg))
+		}
+	}
+
+	if cfg.URL != nil {
+		u, err := url.Parse(*cfg.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("a full, non-relative URL including the protocol must be specified (e.g. https://google.com)", "url")
+		}
+	}
+
+	if cfg.Depth != nil && *cfg.Depth < 0 {
+		invalid("cannot be negative", "depth")
+	}
+
+	if cfg.Timeout != nil && *cfg.Timeout < 0 {
+		invalid("cannot be negative", "timeout")
+	}
+
+	if cfg.Fetch.Timeout != nil && *cfg.Fetch.Timeout <= 0 {
+		invalid("must be positive", "fetch", "timeout")
+	}
+
+	if cfg.Fetch.MaxIdle != nil && *cfg.Fetch.MaxIdle <= 0 {
+		invalid("must be positive", "fetch", "max-idle-per-host")
+	}
+
+	if cfg.Fetch.DialTimeout != nil && *cfg.Fetch.DialTimeout <= 0 {
+		invalid("must be positive", "fetch", "dial-timeout")
+	}
+
+	if cfg.Fetch.TLSTimeout != nil && *cfg.Fetch.TLSTimeout <= 0 {
+		invalid("must be positive", "fetch", "tls-handshake-timeout")
+	}
+
+	if cfg.Fetch.MaxBodySize != nil && *cfg.Fetch.MaxBodySize <= 0 {
+		invalid("must be positive", "fetch", "max-body-size")
+	}
+
+	if cfg.Fetch.Retries != nil && *cfg.Fetch.Retries < 0 {
+		invalid("cannot be negative", "fetch", "retries")
+	}
+
+	if cfg.Fetch.RetryBackoff != nil && *cfg.Fetch.RetryBackoff < 0 {
+		invalid("cannot be negative", "fetch", "retry-backoff")
+	}
+
+	if cfg.Fetch.CacheTTL != nil && *cfg.Fetch.CacheTTL < 0 {
+		invalid("cannot be negative", "fetch", "cache-ttl")
+	}
+
+	if cfg.Fetch.Offline != nil && *cfg.Fetch.Offline && cfg.Fetch.Cache == nil {
+		invalid("requires a cache directory", "fetch", "offline")
+	}
+
+	_, err = resolveOverrides(options{resolve: cfg.resolve()})
+	if err != nil {
+		invalid(strings.TrimPrefix(err.Error(), "invalid resolve "), "fetch", "resolve")
+	}
+
+	if cfg.Fetch.Proxy != nil {
+		_, err := proxyURL(options{proxy: *cfg.Fetch.Proxy})
+		if err != nil {
+			invalid("a URL with an http, https or socks5 protocol must be specified", "fetch", "proxy")
+		}
+	}
+
+	if (cfg.Fetch.ClientCert == nil) != (cfg.Fetch.ClientKey == nil) {
+		invalid("client-cert and client-key must be specified together", "fetch")
+	}
+
+	for i, a := range cfg.Fetch.Auth {
+		if (a.Host == "" || strings.ContainsAny(a.Host, "=/")) && !undecoded[authLine(&root, i)] {
+			errs = append(errs, fmt.Sprintf("%d: fetch.auth[%d].host: a host name (with an optional port) must be specified", authLine(&root, i), i))
+		}
+	}
+
+	if l := cfg.Fetch.Login; l != nil {
+		if l.Page == "" && l.URL == "" {
+			invalid("a login page or url must be specified", "fetch", "login")
+		}
+
+		for key, value := range map[string]string{"page": l.Page, "url": l.URL} {
+			u, err := url.Parse(value)
+			if value != "" && (err != nil || u.Scheme == "" || u.Host == "") {
+				invalid("a full URL including the protocol must be specified", "fetch", "login", key)
+			}
+		}
+
+		if l.Body != "" && l.URL == "" {
+			invalid("a login url is required to send a body", "fetch", "login", "body")
+		}
+
+		if l.Body != "" && len(l.Form) > 0 {
+			invalid("can't be used along with form", "fetch", "login", "body")
+		}
+	}
+
+	if cfg.Output.Format != nil && !validFormat(*cfg.Output.Format) {
+		invalid(fmt.Sprintf("unsupported format %q: must be one of %s", *cfg.Output.Format, strings.Join(formats, ", ")), "output", "format")
+	}
+
+	if cfg.Output.MermaidDepth != nil && *cfg.Output.MermaidDepth < 0 {
+		invalid("cannot be negative", "output", "mermaid-depth")
+	}
+
+	if cfg.Output.MermaidNodes != nil && *cfg.Output.MermaidNodes < 0 {
+		invalid("cannot be negative", "output", "mermaid-nodes")
+	}
+
+	if cfg.Output.Progress != nil && *cfg.Output.Progress < 0 {
+		invalid("cannot be negative", "output", "progress")
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errorLine(errs[i]) < errorLine(errs[j]) })
+
+	return cfg, errs
+}
+
+// errorLine returns the line number at the beginning of the given error.
+func errorLine(e string) int {
+	n, _ := strconv.Atoi(strings.SplitN(e, ":", 2)[0])
+	return n
+}
+
+// apply overrides the given options with the values set in the config file.
+func (cfg fileConfig) apply(opts *options) {
+	setString(&opts.startURL, cfg.URL)
+	setInt(&opts.maxDepth, cfg.Depth)
+	setDuration(&opts.timeout, cfg.Timeout)
+	setString(&opts.metricsAddr, cfg.MetricsAddr)
+	setString(&opts.previous, cfg.Previous)
+	setDuration(&opts.fetchTimeout, cfg.Fetch.Timeout)
+	if cfg.Fetch.MaxBodySize != nil {
+		opts.maxBodySize = *cfg.Fetch.MaxBodySize
+	}
+	setDuration(&opts.keepAlive, cfg.Fetch.KeepAlive)
+	setInt(&opts.maxIdle, cfg.Fetch.MaxIdle)
+	setDuration(&opts.dialTimeout, cfg.Fetch.DialTimeout)
+	setDuration(&opts.tlsTimeout, cfg.Fetch.TLSTimeout)
+	if cfg.Fetch.DisableHTTP2 != nil {
+		opts.disableHTTP2 = *cfg.Fetch.DisableHTTP2
+	}
+	setInt(&opts.retries, cfg.Fetch.Retries)
+	setDuration(&opts.retryBackoff, cfg.Fetch.RetryBackoff)
+	setString(&opts.userAgent, cfg.Fetch.UserAgent)
+	setString(&opts.language, cfg.Fetch.AcceptLanguage)
+	setString(&opts.from, cfg.Fetch.From)
+	opts.resolve = append(opts.resolve, cfg.resolve()...)
+	setString(&opts.proxy, cfg.Fetch.Proxy)
+	setString(&opts.caFile, cfg.Fetch.CAFile)
+	setString(&opts.clientCert, cfg.Fetch.ClientCert)
+	setString(&opts.clientKey, cfg.Fetch.ClientKey)
+	setString(&opts.cookies, cfg.Fetch.Cookies)
+	setString(&opts.cache, cfg.Fetch.Cache)
+	setDuration(&opts.cacheTTL, cfg.Fetch.CacheTTL)
+
+	if cfg.Fetch.Insecure != nil {
+		opts.insecure = *cfg.Fetch.Insecure
+	}
+
+	if cfg.Fetch.Offline != nil {
+		opts.offline = *cfg.Fetch.Offline
+	}
+
+	for _, a := range cfg.Fetch.Auth {
+		if a.Username != "" || a.Password != "" {
+			opts.basicAuth = append(opts.basicAuth, a.Host+"="+os.ExpandEnv(a.Username)+":"+os.ExpandEnv(a.Password))
+		}
+		if a.BearerToken != "" {
+			opts.bearerTokens = append(opts.bearerTokens, a.Host+"="+os.ExpandEnv(a.BearerToken))
+		}
+		for name, value := range a.Headers {
+			opts.headers = append(opts.headers, a.Host+"="+name+": "+os.ExpandEnv(value))
+		}
+	}
+
+	if l := cfg.Fetch.Login; l != nil {
+		opts.login.page = l.Page
+		opts.login.url = l.URL
+		opts.login.body = os.ExpandEnv(l.Body)
+		opts.login.contentType = l.ContentType
+		for name, value := range l.Form {
+			opts.login.fields = append(opts.login.fields, name+"="+os.ExpandEnv(value))
+		}
+	}
+
+	setString(&opts.format, cfg.Output.Format)
+	setInt(&opts.mermaidDepth, cfg.Output.MermaidDepth)
+	setInt(&opts.mermaidNodes, cfg.Output.MermaidNodes)
+	setString(&opts.save, cfg.Output.Save)
+	setString(&opts.store, cfg.Output.Store)
+	setDuration(&opts.progress, cfg.Output.Progress)
+
+	if cfg.Output.Annotate != nil {
+		opts.annotate = *cfg.Output.Annotate
+	}
+}
+
+// resolve returns the resolve overrides of the config file in the format of the resolve flag, host:port:address,
+// where host keys with no port apply to all ports.
+func (cfg fileConfig) resolve() hostValues {
+	var overrides hostValues
+
+	for key, addr := range cfg.Fetch.Resolve {
+		if _, _, err := net.SplitHostPort(key); err != nil {
+			key += ":*"
+		}
+		overrides = append(overrides, key+":"+addr)
+	}
+
+	sort.Strings(overrides)
+
+	return overrides
+}
+
+// configLine returns the line number of the value at the given path of keys, or 0 if it can't be found.
+func configLine(root *yaml.Node, path ...string) int {
+	node := configNode(root, path...)
+	if node == nil {
+		return 0
+	}
+
+	return node.Line
+}
+
+// configNode returns the value at the given path of keys, or nil if it can't be found.
+func configNode(root *yaml.Node, path ...string) *yaml.Node {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+
+	return node
+}
+
+// authLine returns the line number of the given entry of the fetch.auth list, or 0 if it can't be found.
+func authLine(root *yaml.Node, i int) int {
+	node := configNode(root, "fetch", "auth")
+	if node == nil || node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+		return 0
+	}
+
+	return node.Content[i].Line
+}
+
+// yamlErrorLine turns a YAML error such as "line 3: field foo not found in type main.fileConfig"
+// into "3: field foo not found".
+func yamlErrorLine(e string) string {
+	e = strings.TrimPrefix(e, "line ")
+	if i := strings.Index(e, " in type "); i >= 0 {
+		e = e[:i]
+	}
+
+	return e
+}
+
+func setString(dst *string, src *string) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func setInt(dst *int, src *int) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+func setDuration(dst *time.Duration, src *time.Duration) {
+	if src != nil {
+		*dst = *src
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name:     "valid",
+			config:   "url: https://test.com\ndepth: 2\nfetch:\n  timeout: 10s\n",
+			expected: nil,
+		},
+		{
+			name:     "empty",
+			config:   "",
+			expected: nil,
+		},
+		{
+			name:     "unknown key",
+			config:   "url: https://test.com\ndpeth: 2\nfetch:\n  timeot: 10s\n",
+			expected: []string{"2: field dpeth not found", "4: field timeot not found"},
+		},
+		{
+			name:     "type error",
+			config:   "url: https://test.com\nfetch:\n  timeout: abc\n  retries: -1\n",
+			expected: []string{"3: cannot unmarshal !!str `abc` into time.Duration", "4: fetch.retries: cannot be negative"},
+		},
+		{
+			name:     "invalid values",
+			config:   "url: test.com\n\noutput:\n  format: pdf\n",
+			expected: []string{"1: url: a full, non-relative URL including the protocol must be specified (e.g. https://google.com)", `4: output.format: unsupported format "pdf"`},
+		},
+		{
+			name:     "resolve with a port",
+			config:   "url: https://test.com\nfetch:\n  resolve:\n    test.com: 10.0.0.5:8443\n",
+			expected: nil,
+		},
+		{
+			name:     "invalid resolve",
+			config:   "url: https://test.com\nfetch:\n  resolve:\n    test.com: 10.0.0.5:https\n",
+			expected: []string{`4: fetch.resolve: "test.com:*:10.0.0.5:https": the port of the address must be a number`},
+		},
+		{
+			name:     "syntax error",
+			config:   "url: https://test.com\nfetch: [\n",
+			expected: []string{"2: did not find expected node content"},
+		},
+	} {
+		_, errs := parseConfig([]byte(tc.config))
+
+		if len(errs) != len(tc.expected) {
+			t.Errorf("parseConfig(%s): expected %d error(s), got %d: %v", tc.name, len(tc.expected), len(errs), errs)
+			t.FailNow()
+		}
+
+		for i, e := range errs {
+			if !strings.HasPrefix(e, tc.expected[i]) {
+				t.Errorf("parseConfig(%s): expected error %q, got %q", tc.name, tc.expected[i], e)
+			}
+		}
+	}
+}
+
+func TestParseFlagsOverridesConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-config")
+	if err != nil {
+		t.Fatalf("couldn't create a temporary directory: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "crawl.yaml")
+	err = ioutil.WriteFile(file, []byte("url: https://test.com\ndepth: 2\nfetch:\n  timeout: 10s\n"), 0644)
+	if err != nil {
+		t.Fatalf("couldn't write the config file: %s", err.Error())
+	}
+
+	opts, _, err := parseFlags("crawl", []string{"-config", file, "-depth", "4"}, true)
+	if err != nil {
+		t.Errorf("parseFlags(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if opts.startURL != "https://test.com" || opts.fetchTimeout != 10*time.Second {
+		t.Errorf("parseFlags(): expected the values of the config file to be used, got %s and %s", opts.startURL, opts.fetchTimeout)
+	}
+
+	if opts.maxDepth != 4 {
+		t.Errorf("parseFlags(): expected the depth flag to override the config file, got %d", opts.maxDepth)
+	}
+
+	if opts.retries != DefaultRetries {
+		t.Errorf("parseFlags(): expected the default retries for values in neither, got %d", opts.retries)
+	}
+
+	_, _, err = parseFlags("crawl", []string{"-config", file + ".missing"}, true)
+	if err == nil {
+		t.Errorf("parseFlags(): expected an error returned for a missing config file")
+	}
+}
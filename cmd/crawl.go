@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/katzien/crawler/pkg"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// options holds the values of the flags of the crawl, check, stats and compare commands.
+type options struct {
+	config       string
+	startURL     string
+	maxDepth     int
+	timeout      time.Duration
+	fetchTimeout time.Duration
+	graph        bool
+	format       string
+	mermaidDepth int
+	mermaidNodes int
+	annotate     bool
+	save         string
+	store        string
+	previous     string
+	progress     time.Duration
+	metricsAddr  string
+	basicAuth    hostValues
+	bearerTokens hostValues
+	headers      hostValues
+	cookies      string
+	login        loginOptions
+	userAgent    string
+	language     string
+	from         string
+	proxy        string
+	caFile       string
+	clientCert   string
+	clientKey    string
+	insecure     bool
+	retries      int
+	retryBackoff time.Duration
+	maxBodySize  int64
+	keepAlive    time.Duration
+	maxIdle      int
+	disableHTTP2 bool
+	dialTimeout  time.Duration
+	tlsTimeout   time.Duration
+	resolve      hostValues
+	cache        string
+	cacheTTL     time.Duration
+	offline      bool
+	mappings     hostValues
+	cmpFormat    string
+}
+
+// crawlResult holds the outcome of a crawl. Partial is true if the crawl was stopped by the timeout.
+type crawlResult struct {
+	start   *url.URL
+	sitemap *crawler.Sitemap
+	partial bool
+}
+
+// runCrawl crawls a website and outputs the sitemap, e.g.:
+//
+//	crawler crawl -url https://example.com -depth 3 -format tree
+func runCrawl(args []string) (int, error) {
+	opts, fs, err := parseFlags("crawl", args, true)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return ExitUsage, fmt.Errorf("crawl expects no arguments, got %d", fs.NArg())
+	}
+
+	result, err := crawl(opts)
+	if err != nil {
+		return ExitError, err
+	}
+
+	err = render(opts, result.start, result.sitemap)
+	if err != nil {
+		return ExitError, err
+	}
+
+	fmt.Println("Done!")
+
+	if result.partial {
+		return ExitPartial, nil
+	}
+
+	return ExitSuccess, nil
+}
+
+// crawl crawls the website described by the options, saving the results if the save or store flags are set.
+func crawl(opts options) (crawlResult, error) {
+	u, err := url.Parse(opts.startURL)
+	if err != nil {
+		return crawlResult{}, err
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var tInfo string
+
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), opts.timeout)
+		defer cancel()
+		tInfo = fmt.Sprintf(" (timeout %s)", opts.timeout.String())
+	} else {
+		ctx = context.Background()
+		tInfo = " (no timeout specified)"
+	}
+
+	dInfo := ""
+	if opts.maxDepth > 0 {
+		dInfo = fmt.Sprintf(" up to %d level(s) deep", opts.maxDepth)
+	}
+
+	fmt.Printf("Crawling %s%s%s.\n", u.String(), dInfo, tInfo)
+
+	fetch, err := fetchOptions(opts)
+	if err != nil {
+		return crawlResult{}, err
+	}
+
+	c := crawler.NewCrawler(u, opts.maxDepth)
+	c.SetFetchOptions(fetch)
+
+	// The previous crawl is loaded before anything is saved, so that it can be replaced by this one.
+	// A missing file is fine, so that the same flags can be used for the first crawl.
+	var previous crawler.Snapshot
+	if opts.previous != "" {
+		_, statErr := os.Stat(opts.previous)
+		if opts.store == "" && os.IsNotExist(statErr) {
+			fmt.Printf("No previous crawl found in %s, fetching every page.\n", opts.previous)
+			opts.previous = ""
+		} else {
+			previous, err = loadSaved(opts.store, opts.previous)
+			if err != nil {
+				return crawlResult{}, err
+			}
+			c.SetPrevious(previous.Sitemap)
+		}
+	}
+
+	// Logging in before anything else is set up reports wrong credentials straight away.
+	if fetch.Login != nil {
+		err = c.Login(ctx)
+		if err != nil {
+			return crawlResult{}, err
+		}
+	}
+
+	var store crawler.Store
+	var run crawler.Run
+
+	if opts.store != "" {
+		store, err = crawler.NewFileStore(opts.store)
+		if err != nil {
+			return crawlResult{}, err
+		}
+		defer store.Close()
+
+		run, err = store.CreateRun(u.String(), nil)
+		if err != nil {
+			return crawlResult{}, err
+		}
+
+		c.SetStore(store, run.ID)
+	}
+
+	if opts.metricsAddr != "" {
+		m := crawler.NewMetrics()
+		c.SetMetrics(m)
+
+		stopMetrics, err := serveMetrics(opts.metricsAddr, m)
+		if err != nil {
+			return crawlResult{}, err
+		}
+		defer stopMetrics()
+	}
+
+	stopProgress := startProgress(&c, opts.timeout, opts.progress)
+	result := crawlResult{start: u, sitemap: c.Crawl(ctx)}
+	stopProgress()
+
+	stats := c.Stats()
+	fmt.Printf("Fetched %d pages (%d errors) in %s over %d connection(s), reused for %.0f%% of requests.\n",
+		stats.Pages, stats.Errors, stats.Elapsed().Round(time.Millisecond), stats.Connections.Opened, stats.Connections.ReuseRate()*100)
+
+	if fetch.Cache != nil {
+		cs := fetch.Cache.Stats()
+		fmt.Printf("Served %d of %d response(s) from the cache in %s.\n", cs.Hits, cs.Hits+cs.Misses, opts.cache)
+	}
+
+	if opts.previous != "" {
+		reportChanges(previous, result.sitemap, stats)
+	}
+
+	if store != nil {
+		err = store.FinishRun(run.ID)
+		if err != nil {
+			return result, err
+		}
+		fmt.Printf("Crawl results saved in %s as run %s.\n", opts.store, run.ID)
+	}
+
+	if ctx.Err() != nil && ctx.Err() == context.DeadlineExceeded {
+		fmt.Println("Max crawling time exceeded, saving current results...")
+		result.partial = true
+	}
+
+	if opts.save != "" {
+		err = crawler.SaveSnapshot(opts.save, crawler.Snapshot{Start: u.String(), Time: time.Now(), Sitemap: result.sitemap})
+		if err != nil {
+			return result, err
+		}
+		fmt.Printf("Crawl results saved in %s.\n", opts.save)
+	}
+
+	return result, nil
+}
+
+// reportChanges lists the pages which changed since the previous crawl, along with the pages added and removed.
+func reportChanges(previous crawler.Snapshot, sitemap *crawler.Sitemap, stats crawler.Stats) {
+	d := crawler.Diff(previous, crawler.Snapshot{Sitemap: sitemap})
+
+	fmt.Printf("%d page(s) not modified since the previous crawl, %d changed, %d added and %d removed.\n",
+		stats.NotModified, len(d.ChangedPages), len(d.AddedPages), len(d.RemovedPages))
+
+	for _, p := range d.ChangedPages {
+		fmt.Printf("~ %s\n", p)
+	}
+	for _, p := range d.AddedPages {
+		fmt.Printf("+ %s\n", p)
+	}
+	for _, p := range d.RemovedPages {
+		fmt.Printf("- %s\n", p)
+	}
+}
+
+// serveMetrics serves the given metrics on /metrics at the given address until the returned function is called.
+func serveMetrics(addr string, m *crawler.Metrics) (func(), error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s: %s", addr, err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+
+	fmt.Printf("Serving metrics on http://%s/metrics.\n", l.Addr().String())
+
+	return func() { srv.Close() }, nil
+}
+
+// crawlOrLoad crawls the website described by the options, or loads a saved crawl if one is given as an argument.
+// Saved crawls are files saved with the save flag, or run IDs if the store flag is set.
+func crawlOrLoad(opts options, fs *flag.FlagSet) (crawlResult, error) {
+	if fs.NArg() == 0 {
+		return crawl(opts)
+	}
+
+	return loadResult(opts.store, fs.Arg(0))
+}
+
+// loadResult loads a saved crawl as the result of a crawl (see loadSaved).
+func loadResult(storeDir string, name string) (crawlResult, error) {
+	snap, err := loadSaved(storeDir, name)
+	if err != nil {
+		return crawlResult{}, err
+	}
+
+	start, err := url.Parse(snap.Start)
+	if err != nil {
+		return crawlResult{}, fmt.Errorf("error parsing the starting URL of the saved crawl: %s", err.Error())
+	}
+
+	return crawlResult{start: start, sitemap: snap.Sitemap}, nil
+}
+
+// loadSaved loads a crawl saved with the save flag, or a run saved in the given store directory if it's set.
+func loadSaved(storeDir string, name string) (crawler.Snapshot, error) {
+	if storeDir == "" {
+		return crawler.LoadSnapshot(name)
+	}
+
+	store, err := crawler.NewFileStore(storeDir)
+	if err != nil {
+		return crawler.Snapshot{}, err
+	}
+	defer store.Close()
+
+	return store.Snapshot(name)
+}
+
+// render outputs the sitemap in the format specified by the options,
+// either printing it on the screen or saving it to a file.
+func render(opts options, start *url.URL, sitemap *crawler.Sitemap) error {
+	switch opts.format {
+	case "svg":
+		err := crawler.Graph(sitemap)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sitemap graph file saved in %s.\n", crawler.DefaultOutputFileSvg)
+	case "html":
+		err := crawler.HTML(sitemap)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sitemap report saved in %s.\n", crawler.DefaultOutputFileHTML)
+	case "graphml":
+		err := crawler.GraphML(sitemap)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sitemap graph file saved in %s.\n", crawler.DefaultOutputFileGraphML)
+	case "gexf":
+		err := crawler.GEXF(sitemap)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sitemap graph file saved in %s.\n", crawler.DefaultOutputFileGEXF)
+	case "csv":
+		err := crawler.CSV(sitemap)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Sitemap node and edge lists saved in %s and %s.\n", crawler.DefaultOutputFileNodesCSV, crawler.DefaultOutputFileEdgesCSV)
+	case "tree":
+		tree, err := crawler.Tree(sitemap, opts.annotate)
+		if err != nil {
+			return err
+		}
+		fmt.Println(tree)
+	case "stats":
+		report, err := crawler.AnalysisReport(crawler.Analyse(sitemap, startPage(start, sitemap)))
+		if err != nil {
+			return err
+		}
+		fmt.Println(report)
+	case "markdown":
+		md, err := crawler.Markdown(sitemap)
+		if err != nil {
+			return err
+		}
+		fmt.Println(md)
+	case "mermaid":
+		chart, err := crawler.Mermaid(sitemap, opts.mermaidDepth, opts.mermaidNodes)
+		if err != nil {
+			return err
+		}
+		fmt.Println(chart)
+	default:
+		text, err := crawler.Text(sitemap)
+		if err != nil {
+			return err
+		}
+		fmt.Println(text)
+	}
+
+	return nil
+}
+
+// startPage returns the address the starting URL was saved under in the sitemap,
+// which is different from the starting URL if it redirected elsewhere.
+func startPage(start *url.URL, sitemap *crawler.Sitemap) crawler.CanonicalURL {
+	u := crawler.CanonicalURL(start.String())
+
+	n, ok := sitemap.Node(u)
+	if ok && n.RedirectsTo != "" {
+		return n.RedirectsTo
+	}
+
+	return u
+}
+
+// parseFlags parses the flags of the given command, along with the output flags if output is true.
+// If a config file is given with the config flag, its values are used instead of the defaults,
+// and flags given on the command line override them. The options are validated once parsed.
+func parseFlags(name string, args []string, output bool) (options, *flag.FlagSet, error) {
+	opts := defaultOptions()
+
+	fs := crawlFlags(name, &opts, output)
+	err := fs.Parse(args)
+	if err != nil {
+		return opts, fs, err
+	}
+
+	if opts.config != "" {
+		cfg, err := loadConfig(opts.config)
+		if err != nil {
+			return opts, fs, err
+		}
+
+		opts = defaultOptions()
+		cfg.apply(&opts)
+
+		// Parsing the flags again on top of the config file values makes the flags take precedence.
+		fs = crawlFlags(name, &opts, output)
+		err = fs.Parse(args)
+		if err != nil {
+			return opts, fs, err
+		}
+	}
+
+	if opts.graph {
+		opts.format = "svg"
+	}
+
+	return opts, fs, opts.validate()
+}
+
+func defaultOptions() options {
+	return options{
+		startURL:     DefaultURL,
+		maxDepth:     DefaultDepth,
+		timeout:      DefaultTimeout,
+		fetchTimeout: crawler.FetchTimeout,
+		userAgent:    crawler.DefaultUserAgent,
+		maxBodySize:  crawler.DefaultMaxBodySize,
+		keepAlive:    crawler.DefaultKeepAlive,
+		maxIdle:      crawler.DefaultMaxIdleConnsPerHost,
+		dialTimeout:  crawler.DefaultDialTimeout,
+		tlsTimeout:   crawler.DefaultTLSHandshakeTimeout,
+		retries:      DefaultRetries,
+		retryBackoff: crawler.DefaultRetryBackoff,
+		cacheTTL:     crawler.DefaultCacheTTL,
+		graph:        DefaultGraph,
+		format:       DefaultFormat,
+		mermaidDepth: DefaultMermaidDepth,
+		mermaidNodes: DefaultMermaidNodes,
+		annotate:     DefaultAnnotate,
+		progress:     DefaultProgressInterval,
+		cmpFormat:    DefaultCompareFormat,
+	}
+}
+
+// validate checks the options for values which don't make sense, e.g. negative depths.
+func (opts options) validate() error {
+	u, err := url.Parse(opts.startURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid URL: a full, non-relative URL including the protocol must be specified (e.g. https://google.com)")
+	}
+
+	if opts.maxDepth < 0 {
+		return fmt.Errorf("depth cannot be negative")
+	}
+
+	if opts.timeout < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+
+	if opts.fetchTimeout <= 0 {
+		return fmt.Errorf("fetch-timeout must be positive")
+	}
+
+	if opts.maxIdle <= 0 || opts.dialTimeout <= 0 || opts.tlsTimeout <= 0 {
+		return fmt.Errorf("max-idle-per-host, dial-timeout and tls-handshake-timeout must be positive")
+	}
+
+	if opts.maxBodySize <= 0 {
+		return fmt.Errorf("max-body-size must be positive")
+	}
+
+	if opts.retries < 0 || opts.retryBackoff < 0 {
+		return fmt.Errorf("retries and retry-backoff cannot be negative")
+	}
+
+	if opts.cacheTTL < 0 {
+		return fmt.Errorf("cache-ttl cannot be negative")
+	}
+
+	if opts.offline && opts.cache == "" {
+		return fmt.Errorf("offline requires a cache directory to be set with cache")
+	}
+
+	if opts.progress < 0 {
+		return fmt.Errorf("progress cannot be negative")
+	}
+
+	_, err = credentials(opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = login(opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = proxyURL(opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = resolveOverrides(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.mermaidDepth < 0 || opts.mermaidNodes < 0 {
+		return fmt.Errorf("mermaid-depth and mermaid-nodes cannot be negative")
+	}
+
+	if !validFormat(opts.format) {
+		return fmt.Errorf("unsupported format %q: must be one of %s", opts.format, strings.Join(formats, ", "))
+	}
+
+	return nil
+}
+
+// crawlFlags returns the flags of the given command, using the current values of the given options as defaults.
+// The output flags are only included if output is true.
+func crawlFlags(name string, opts *options, output bool) *flag.FlagSet {
+	var fs *flag.FlagSet
+
+	switch name {
+	case "crawl":
+		fs = newFlagSet(name, "[flags]", "Crawls a website and outputs the sitemap.")
+	case "check":
+		fs = newFlagSet(name, "[flags] [saved crawl]",
+			fmt.Sprintf("Crawls a website, or loads a saved crawl, and lists the broken links.\nExits with code %d if any broken links are found.", ExitFindings))
+	case "stats":
+		fs = newFlagSet(name, "[flags] [saved crawl]", "Crawls a website, or loads a saved crawl, and prints link graph analytics.")
+	case "compare":
+		fs = newFlagSet(name, "[flags] <left> <right>",
+			fmt.Sprintf("Crawls two deployments of the same site in parallel given their base URLs, e.g. staging and production, and compares them.\nSaved crawls can be given instead of URLs. Exits with code %d if they differ.", ExitFindings))
+	}
+
+	fs.StringVar(&opts.config, "config", opts.config, "YAML config file describing the crawl (see the README for the layout). Flags given on the command line override the values in the file.")
+	if name != "compare" {
+		fs.StringVar(&opts.startURL, "url", opts.startURL, fmt.Sprintf("Full URL of the website to be crawled, e.g. https://google.com (defaults to %s if not specified)", DefaultURL))
+	}
+	fs.IntVar(&opts.maxDepth, "depth", opts.maxDepth, fmt.Sprintf("Number of nested levels to parse (0 for unlimited; defaults to %d)", DefaultDepth))
+	fs.DurationVar(&opts.timeout, "timeout", opts.timeout, fmt.Sprintf("Max allowed crawling time in seconds (0 for unlimited; defaults to %s)", DefaultTimeout.String()))
+	fs.DurationVar(&opts.fetchTimeout, "fetch-timeout", opts.fetchTimeout, fmt.Sprintf("Max time allowed to fetch a single page (defaults to %s)", crawler.FetchTimeout.String()))
+	fetchFlags(fs, opts)
+	fs.DurationVar(&opts.progress, "progress", opts.progress, fmt.Sprintf("Interval between progress log lines when the output isn't a terminal, which shows a live progress line instead (0 disables progress reporting; defaults to %s)", DefaultProgressInterval.String()))
+	fs.StringVar(&opts.metricsAddr, "metrics-addr", opts.metricsAddr, "Serves Prometheus metrics on /metrics at the given address (e.g. :9090) while crawling.")
+	fs.StringVar(&opts.save, "save", opts.save, "Saves the crawl results to the given JSON file, so that they can be compared with another crawl later using the diff command.")
+	fs.StringVar(&opts.store, "store", opts.store, "Saves every page to the given store directory as soon as it's crawled, as a new crawl run. If a saved crawl is given, it's the ID of a run in this store.")
+	if name != "compare" {
+		fs.StringVar(&opts.previous, "previous", opts.previous, "Previous crawl of the site, saved with -save (or a run ID with -store). Pages which weren't modified since then aren't downloaded again, and the pages which changed are listed.")
+	}
+
+	if output {
+		outputFlags(fs, opts)
+	}
+
+	if name == "compare" {
+		fs.Var(&opts.mappings, "map", "Maps the pages under a path on the left to the pages under another path on the right, as from=to (e.g. /en=/). Can be repeated, the first matching mapping is applied.")
+		fs.StringVar(&opts.cmpFormat, "format", opts.cmpFormat, fmt.Sprintf("Output format: text or json (defaults to %s).", DefaultCompareFormat))
+	}
+
+	return fs
+}
+
+// outputFlags adds the flags controlling the output format to the given flag set.
+func outputFlags(fs *flag.FlagSet, opts *options) {
+	fs.BoolVar(&opts.graph, "graph", opts.graph, fmt.Sprintf("Renders the sitemap as a graph saved to an .svg file rather than as text on the screen. Graphviz (dot) is required for this to work."))
+	fs.StringVar(&opts.format, "format", opts.format, fmt.Sprintf("Output format: %s (defaults to %s). Formats other than text, tree, stats, markdown and mermaid are saved to a file.", strings.Join(formats, ", "), DefaultFormat))
+	fs.IntVar(&opts.mermaidDepth, "mermaid-depth", opts.mermaidDepth, fmt.Sprintf("Max depth of the pages included in the mermaid output (0 for unlimited; defaults to %d)", DefaultMermaidDepth))
+	fs.IntVar(&opts.mermaidNodes, "mermaid-nodes", opts.mermaidNodes, fmt.Sprintf("Max number of pages included in the mermaid output (0 for unlimited; defaults to %d)", DefaultMermaidNodes))
+	fs.BoolVar(&opts.annotate, "annotate", opts.annotate, "Annotates the pages in the tree output with their status code and title.")
+}
+
+func validFormat(format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
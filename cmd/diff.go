@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"github.com/katzien/crawler/pkg"
+)
+
+// DefaultDiffFormat is the default output format of the diff command if no format flag has been specified.
+// Supported formats are "text", "json" and "svg".
+const DefaultDiffFormat = "text"
+
+// runDiff compares two crawls previously saved with the save flag, or two runs saved in a store, e.g.:
+//
+//	crawler diff -format json before.json after.json
+//	crawler diff -store crawls 20181031T231858.000000000Z 20181101T094512.000000000Z
+//
+// It exits with ExitFindings if the crawls differ.
+func runDiff(args []string) (int, error) {
+	fs := newFlagSet("diff", "[-format text|json|svg] [-store dir] <before> <after>",
+		fmt.Sprintf("Compares two crawls saved with the -save flag, or two run IDs saved with the -store flag.\nExits with code %d if the crawls differ.", ExitFindings))
+	f := fs.String("format", DefaultDiffFormat, fmt.Sprintf("Output format: text, json or svg (defaults to %s). The svg graph is saved to %s.", DefaultDiffFormat, crawler.DefaultOutputFileDiffSvg))
+	st := fs.String("store", "", "Compares two runs saved in the given store directory, rather than two files.")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return ExitUsage, fmt.Errorf("diff expects exactly two saved crawls, got %d", fs.NArg())
+	}
+
+	if *f != "text" && *f != "json" && *f != "svg" {
+		return ExitUsage, fmt.Errorf("unsupported format %q: must be one of text, json or svg", *f)
+	}
+
+	before, err := loadSaved(*st, fs.Arg(0))
+	if err != nil {
+		return ExitError, err
+	}
+
+	after, err := loadSaved(*st, fs.Arg(1))
+	if err != nil {
+		return ExitError, err
+	}
+
+	d := crawler.Diff(before, after)
+
+	switch *f {
+	case "text":
+		text, err := crawler.DiffText(d)
+		if err != nil {
+			return ExitError, err
+		}
+		fmt.Println(text)
+	case "json":
+		js, err := crawler.DiffJSON(d)
+		if err != nil {
+			return ExitError, err
+		}
+		fmt.Println(js)
+	case "svg":
+		err := crawler.DiffGraph(before, after)
+		if err != nil {
+			return ExitError, err
+		}
+		fmt.Printf("Sitemap diff graph file saved in %s.\n", crawler.DefaultOutputFileDiffSvg)
+	}
+
+	if !d.Empty() {
+		return ExitFindings, nil
+	}
+
+	return ExitSuccess, nil
+}
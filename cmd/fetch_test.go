@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveOverrides(t *testing.T) {
+	for _, tc := range []struct {
+		resolve  string
+		key      string
+		expected string
+		err      string
+	}{
+		{resolve: "example.com:443:10.0.0.5", key: "example.com:443", expected: "10.0.0.5"},
+		{resolve: "example.com:*:10.0.0.5", key: "example.com", expected: "10.0.0.5"},
+		{resolve: "example.com:443:10.0.0.5:8443", key: "example.com:443", expected: "10.0.0.5:8443"},
+		{resolve: "example.com:443:[::1]", key: "example.com:443", expected: "::1"},
+		{resolve: "example.com:443:::1", key: "example.com:443", expected: "::1"},
+		{resolve: "example.com:443:[::1]:8443", key: "example.com:443", expected: "[::1]:8443"},
+		{resolve: "example.com:80:unix:///run/app.sock", key: "example.com:80", expected: "unix:///run/app.sock"},
+		{resolve: "example.com:443", err: "overrides must be given as host:port:address"},
+		{resolve: "example.com:https:10.0.0.5", err: "the port must be a number or *"},
+		{resolve: "example.com:443:10.0.0.5:https", err: "the port of the address must be a number"},
+		{resolve: "example.com:443:10.0.0.5:", err: "the port of the address must be a number"},
+		{resolve: "example.com:443:app.local:8443", err: "the address must be an IP address"},
+	} {
+		overrides, err := resolveOverrides(options{resolve: hostValues{tc.resolve}})
+
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("resolveOverrides(%s): expected an error containing %q, got %v", tc.resolve, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("resolveOverrides(%s): expected no error returned, got %s", tc.resolve, err.Error())
+			t.FailNow()
+		}
+
+		if len(overrides) != 1 || overrides[tc.key] != tc.expected {
+			t.Errorf("resolveOverrides(%s): expected %s to resolve to %s, got %v", tc.resolve, tc.key, tc.expected, overrides)
+		}
+	}
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
-	"github.com/katzien/crawler/pkg"
 	"log"
-	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -25,81 +25,129 @@ const (
 	// If the graph flag is specified, the sitemap will be rendered as a graph and saved to an .svg file instead.
 	// A program called "dot" (part of Graphviz) is required to render the graph file.
 	DefaultGraph = false
+
+	// DefaultFormat is the default output format if no format flag has been specified.
+	// Supported formats are "text", "tree", "stats", "markdown", "mermaid", "html", "svg" (same as the graph flag), "graphml", "gexf" and "csv".
+	DefaultFormat = "text"
+
+	// DefaultMermaidDepth is the default max depth of the pages included in the mermaid output (0 for unlimited).
+	DefaultMermaidDepth = 0
+
+	// DefaultMermaidNodes is the default max number of pages included in the mermaid output (0 for unlimited).
+	// Mermaid flowcharts with more nodes than this tend to be unreadable.
+	DefaultMermaidNodes = 50
+
+	// DefaultRetries is the default number of times a page is fetched again after a transient failure.
+	DefaultRetries = 2
+
+	// DefaultAnnotate specifies whether pages in the tree output are annotated with their status code and title.
+	DefaultAnnotate = false
 )
 
-func main() {
+// Exit codes, so that scripts and CI jobs can tell apart the different outcomes of a command.
+const (
+	// ExitSuccess is returned when the command completed and found nothing to report.
+	ExitSuccess = 0
 
-	startURL, maxDepth, timeout, graph := parseFlags()
+	// ExitError is returned when the command failed.
+	ExitError = 1
 
-	u, err := url.Parse(startURL)
-	if err != nil {
-		log.Fatal(err)
-	}
+	// ExitUsage is returned when the command line flags or arguments are invalid.
+	ExitUsage = 2
 
-	if u.Scheme == "" || u.Host == "" {
-		log.Fatal("invalid URL: a full, non-relative URL including the protocol must be specified (e.g. https://google.com)")
-	}
+	// ExitPartial is returned when the crawl was stopped by the timeout, so the results only cover part of the site.
+	ExitPartial = 3
 
-	if maxDepth < 0 {
-		log.Fatal("depth cannot be negative")
-	}
+	// ExitFindings is returned when the command found problems, e.g. broken links found by check
+	// or differences found by diff. It takes precedence over ExitPartial.
+	ExitFindings = 4
+)
 
-	if timeout < 0 {
-		log.Fatal("timeout cannot be negative")
-	}
+// formats lists the supported output formats.
+var formats = []string{"text", "tree", "stats", "markdown", "mermaid", "html", "svg", "graphml", "gexf", "csv"}
 
-	var ctx context.Context
-	var cancel context.CancelFunc
-	var tInfo string
-
-	if timeout > 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), timeout)
-		defer cancel()
-		tInfo = fmt.Sprintf(" (timeout %s)", timeout.String())
-	} else {
-		ctx = context.Background()
-		tInfo = " (no timeout specified)"
-	}
+// command is a single subcommand of the CLI. Commands return the exit code the program should exit with,
+// along with any error which made them fail.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) (int, error)
+}
 
-	dInfo := ""
-	if maxDepth > 0 {
-		dInfo = fmt.Sprintf(" up to %d level(s) deep", maxDepth)
+var commands []command
+
+func init() {
+	commands = []command{
+		{"crawl", "Crawls a website and outputs the sitemap (the default command).", runCrawl},
+		{"render", "Outputs a saved crawl in any of the supported formats.", runRender},
+		{"check", "Crawls a website (or loads a saved crawl) and reports the broken links.", runCheck},
+		{"stats", "Crawls a website (or loads a saved crawl) and reports link graph analytics.", runStats},
+		{"diff", "Compares two saved crawls.", runDiff},
+		{"compare", "Crawls two deployments of a site in parallel (e.g. staging and production) and compares them.", runCompare},
+		{"runs", "Lists the crawl runs saved in a store.", runRuns},
+		{"config", "Validates a config file.", runConfig},
+		{"serve", "Runs the crawler as an HTTP service with a REST API for crawl jobs.", runServe},
 	}
+}
 
-	fmt.Printf("Crawling %s%s%s.\n", u.String(), dInfo, tInfo)
-
-	c := crawler.NewCrawler(u, maxDepth)
+func main() {
+	name, args := "crawl", os.Args[1:]
 
-	sitemap := c.Crawl(ctx)
+	// Running the program with flags only (or nothing at all) runs the crawl command.
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	if ctx.Err() != nil && ctx.Err() == context.DeadlineExceeded {
-		fmt.Println("Max crawling time exceeded, saving current results...")
+	if name == "help" {
+		usage()
+		return
 	}
 
-	if graph {
-		err = crawler.Graph(sitemap)
-		if err != nil {
-			log.Fatal(err.Error())
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		code, err := cmd.run(args)
+		if err == flag.ErrHelp {
+			os.Exit(ExitSuccess)
 		}
-		fmt.Printf("Sitemap graph file saved in %s.\n", crawler.DefaultOutputFileSvg)
-	} else {
-		text, err := crawler.Text(sitemap)
 		if err != nil {
-			log.Fatal(err.Error())
+			log.Print(err.Error())
+			if code == ExitSuccess {
+				code = ExitError
+			}
 		}
-		fmt.Println(text)
+
+		os.Exit(code)
 	}
 
-	fmt.Println("Done!")
+	usage()
+	log.Printf("unknown command %q", name)
+	os.Exit(ExitUsage)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n\n", programName())
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun %s <command> -h for the flags of a command.\n", programName())
+	fmt.Fprintf(os.Stderr, "Exit codes: %d success, %d error, %d invalid usage, %d partial results (timeout), %d findings.\n",
+		ExitSuccess, ExitError, ExitUsage, ExitPartial, ExitFindings)
 }
 
-func parseFlags() (string, int, time.Duration, bool) {
-	u := flag.String("url", DefaultURL, fmt.Sprintf("Full URL of the website to be crawled, e.g. https://google.com (defaults to %s if not specified)", DefaultURL))
-	d := flag.Int("depth", DefaultDepth, fmt.Sprintf("Number of nested levels to parse (0 for unlimited; defaults to %d)", DefaultDepth))
-	t := flag.Duration("timeout", DefaultTimeout, fmt.Sprintf("Max allowed crawling time in seconds (0 for unlimited; defaults to %s)", DefaultTimeout.String()))
-	g := flag.Bool("graph", DefaultGraph, fmt.Sprintf("Renders the sitemap as a graph saved to an .svg file rather than as text on the screen. Graphviz (dot) is required for this to work."))
+// newFlagSet returns the flag set of the given command, whose help text shows the given usage line and description.
+func newFlagSet(name string, usage string, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s %s\n\n%s\n\n", programName(), name, usage, description)
+		fs.PrintDefaults()
+	}
 
-	flag.Parse()
+	return fs
+}
 
-	return *u, *d, *t, *g
+func programName() string {
+	return filepath.Base(os.Args[0])
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"github.com/katzien/crawler/pkg"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultProgressInterval is the default interval between progress log lines when the output isn't a terminal.
+	DefaultProgressInterval = 10 * time.Second
+
+	// progressRefresh is how often the progress line is redrawn when the output is a terminal.
+	progressRefresh = 250 * time.Millisecond
+)
+
+// startProgress reports the progress of the given crawl until the returned function is called.
+// If stdout is a terminal, a single progress line is redrawn in place and cleared once the crawl stops.
+// Otherwise a progress log line is printed every interval. An interval of 0 disables progress reporting.
+func startProgress(c *crawler.Crawler, timeout time.Duration, interval time.Duration) func() {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	tty := isTerminal(os.Stdout)
+	if tty {
+		interval = progressRefresh
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				if tty {
+					fmt.Print("\r\033[K")
+				}
+				return
+			case <-ticker.C:
+				if tty {
+					fmt.Printf("\r%s\033[K", progressLine(c.Stats(), timeout))
+				} else {
+					log.Print(progressLine(c.Stats(), timeout))
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// progressLine describes the given progress, e.g.
+// "120 pages fetched, 3 errors, 45 queued, 4.2 pages/s, 28s elapsed of 1m0s".
+func progressLine(s crawler.Stats, timeout time.Duration) string {
+	limit := "no timeout"
+	if timeout > 0 {
+		limit = "of " + timeout.String()
+	}
+
+	return fmt.Sprintf("%d pages fetched, %d errors, %d queued, %.1f pages/s, %s elapsed %s",
+		s.Pages, s.Errors, s.Queued, s.Rate(), s.Elapsed().Round(time.Second), limit)
+}
+
+// isTerminal returns true if the given file is a terminal rather than e.g. a pipe or a regular file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
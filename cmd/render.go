@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// runRender outputs a crawl previously saved with the save flag, or a run saved in a store, in any of the
+// supported formats without crawling the site again, e.g.:
+//
+//	crawler render -format tree -annotate crawl.json
+//	crawler render -store crawls -format html 20181031T231858.000000000Z
+func runRender(args []string) (int, error) {
+	opts := defaultOptions()
+
+	fs := newFlagSet("render", "[flags] <saved crawl>", "Outputs a crawl saved with the -save flag, or a run ID saved with the -store flag.")
+	fs.StringVar(&opts.store, "store", "", "Renders a run saved in the given store directory, rather than a file.")
+	outputFlags(fs, &opts)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return ExitUsage, fmt.Errorf("render expects exactly one saved crawl, got %d", fs.NArg())
+	}
+
+	if opts.graph {
+		opts.format = "svg"
+	}
+
+	err = opts.validate()
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	snap, err := loadSaved(opts.store, fs.Arg(0))
+	if err != nil {
+		return ExitError, err
+	}
+
+	start, err := url.Parse(snap.Start)
+	if err != nil {
+		return ExitError, fmt.Errorf("error parsing the starting URL of the saved crawl: %s", err.Error())
+	}
+
+	err = render(opts, start, snap.Sitemap)
+	if err != nil {
+		return ExitError, err
+	}
+
+	return ExitSuccess, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/katzien/crawler/pkg"
+	"time"
+)
+
+// runRuns lists the crawl runs saved in a store with the store flag, e.g.:
+//
+//	crawler runs -store crawls
+func runRuns(args []string) (int, error) {
+	fs := newFlagSet("runs", "-store dir", "Lists the crawl runs saved with the -store flag, oldest first.")
+	st := fs.String("store", "", "Store directory to list the crawl runs of (required).")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if *st == "" {
+		fs.Usage()
+		return ExitUsage, fmt.Errorf("runs expects a store directory")
+	}
+
+	store, err := crawler.NewFileStore(*st)
+	if err != nil {
+		return ExitError, err
+	}
+	defer store.Close()
+
+	runs, err := store.Runs()
+	if err != nil {
+		return ExitError, err
+	}
+
+	for _, run := range runs {
+		snap, err := store.Snapshot(run.ID)
+		if err != nil {
+			return ExitError, err
+		}
+
+		status := "unfinished"
+		if !run.Finished.IsZero() {
+			status = "took " + run.Finished.Sub(run.Started).Round(time.Second).String()
+		}
+
+		fmt.Printf("%s  %s  %d pages  %s\n", run.ID, run.Start, len(snap.Sitemap.Pages()), status)
+	}
+
+	return ExitSuccess, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/katzien/crawler/pkg"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultAddr is the default address the serve command listens on.
+	DefaultAddr = ":8080"
+
+	// DefaultServeDir is the default directory the serve command keeps its jobs and crawl results in.
+	DefaultServeDir = "crawler-data"
+)
+
+// runServe runs the crawler as an HTTP service, with a REST API to submit, poll, cancel and download crawl jobs, e.g.:
+//
+//	crawler serve -addr :8080 -dir crawler-data -workers 4
+//
+// It runs until it's interrupted, then waits for the running jobs to stop. They're run again on the next start.
+func runServe(args []string) (int, error) {
+	fs := newFlagSet("serve", "[flags]", "Runs the crawler as an HTTP service with a REST API for crawl jobs (see the README for the endpoints).")
+	addr := fs.String("addr", DefaultAddr, fmt.Sprintf("Address to listen on (defaults to %s)", DefaultAddr))
+	dir := fs.String("dir", DefaultServeDir, fmt.Sprintf("Directory to keep the jobs and their results in, so that they survive a restart (defaults to %s)", DefaultServeDir))
+	metrics := fs.Bool("metrics", false, "Serves Prometheus metrics of all the jobs on /metrics.")
+	workers := fs.Int("workers", crawler.DefaultWorkers, fmt.Sprintf("Max number of crawl jobs run at the same time (defaults to %d)", crawler.DefaultWorkers))
+
+	err := fs.Parse(args)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return ExitUsage, fmt.Errorf("serve expects no arguments, got %d", fs.NArg())
+	}
+
+	if *workers < 1 {
+		return ExitUsage, fmt.Errorf("workers must be positive")
+	}
+
+	s, err := crawler.NewServer(*dir, *workers)
+	if err != nil {
+		return ExitError, err
+	}
+
+	if *metrics {
+		s.SetMetrics(crawler.NewMetrics())
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: s}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	log.Printf("Listening on %s with %d worker(s), saving jobs in %s.", *addr, *workers, *dir)
+
+	select {
+	case err = <-errs:
+		s.Close()
+		return ExitError, err
+	case <-stop:
+	}
+
+	log.Print("Shutting down, unfinished jobs will be run again on the next start...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = srv.Shutdown(ctx)
+	if err != nil {
+		return ExitError, err
+	}
+
+	err = s.Close()
+	if err != nil {
+		return ExitError, err
+	}
+
+	return ExitSuccess, nil
+}
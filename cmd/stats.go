@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"github.com/katzien/crawler/pkg"
+)
+
+// runStats crawls a website, or loads a saved crawl, and prints link graph analytics such as click depths,
+// internal PageRank, dead ends and orphans, e.g.:
+//
+//	crawler stats -url https://example.com
+//	crawler stats -store crawls 20181031T231858.000000000Z
+//
+// It exits with ExitPartial if the crawl timed out.
+func runStats(args []string) (int, error) {
+	opts, fs, err := parseFlags("stats", args, false)
+	if err != nil {
+		return ExitUsage, err
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return ExitUsage, fmt.Errorf("stats expects at most one saved crawl, got %d", fs.NArg())
+	}
+
+	result, err := crawlOrLoad(opts, fs)
+	if err != nil {
+		return ExitError, err
+	}
+
+	report, err := crawler.AnalysisReport(crawler.Analyse(result.sitemap, startPage(result.start, result.sitemap)))
+	if err != nil {
+		return ExitError, err
+	}
+
+	fmt.Println(report)
+
+	if result.partial {
+		return ExitPartial, nil
+	}
+
+	return ExitSuccess, nil
+}
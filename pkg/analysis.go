@@ -0,0 +1,386 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// PageRankDamping is the damping factor used when computing the internal PageRank of pages.
+	PageRankDamping = 0.85
+
+	// PageRankIterations is the max number of iterations used when computing the internal PageRank of pages.
+	PageRankIterations = 100
+
+	// PageRankTolerance is the total change in PageRank between two iterations below which the computation stops.
+	PageRankTolerance = 1e-6
+)
+
+// Analysis holds metrics computed over the link graph of a sitemap.
+// All the pages and link targets in the sitemap are taken into account, even if they haven't been crawled.
+// Self-links (pages linking to themselves) are ignored.
+type Analysis struct {
+	// Start is the page the click depth is calculated from.
+	Start CanonicalURL
+
+	// InDegree and OutDegree hold the number of internal links pointing to and from every page.
+	InDegree  map[CanonicalURL]int
+	OutDegree map[CanonicalURL]int
+
+	// PageRank holds the internal PageRank of every page. All the values add up to 1.
+	PageRank map[CanonicalURL]float64
+
+	// ClickDepth holds the min number of clicks needed to get to every page from the start page.
+	// Pages which can't be reached from the start page are listed in Unreachable instead.
+	ClickDepth  map[CanonicalURL]int
+	Unreachable []CanonicalURL
+
+	// DepthDistribution holds the number of pages at every click depth, indexed by depth.
+	DepthDistribution []int
+
+	// Components holds the strongly connected components of the graph (sets of pages which can all reach each other),
+	// largest first. Pages which aren't part of any cycle form single-page components.
+	Components [][]CanonicalURL
+
+	// DeadEnds holds the crawled pages with no outgoing internal links.
+	DeadEnds []CanonicalURL
+
+	// Orphans holds the pages (other than the start page) with no inbound links.
+	Orphans []CanonicalURL
+
+	// SingleLink holds the pages (other than the start page) which are only linked to from a single page.
+	SingleLink []CanonicalURL
+}
+
+// Analyse computes link graph metrics for the given sitemap, such as in-degree and out-degree, internal PageRank,
+// click depth from the given start page and strongly connected components.
+// It also finds dead ends, orphans and pages which are only reachable through a single link.
+// External pages and the links pointing to them are left out of the analysis.
+func Analyse(s *Sitemap, start CanonicalURL) Analysis {
+	s = s.Internal()
+
+	var nodes []string
+	for _, n := range s.Nodes() {
+		nodes = append(nodes, string(n.URL))
+	}
+
+	adjacency := getAdjacency(s)
+
+	a := Analysis{
+		Start:      start,
+		InDegree:   make(map[CanonicalURL]int),
+		OutDegree:  make(map[CanonicalURL]int),
+		ClickDepth: make(map[CanonicalURL]int),
+	}
+
+	for _, node := range nodes {
+		a.InDegree[CanonicalURL(node)] = 0
+	}
+
+	for _, node := range nodes {
+		u := CanonicalURL(node)
+		a.OutDegree[u] = len(adjacency[u])
+
+		for _, target := range adjacency[u] {
+			a.InDegree[target]++
+		}
+	}
+
+	for _, node := range nodes {
+		u := CanonicalURL(node)
+
+		if s.Crawled(u) && a.OutDegree[u] == 0 {
+			a.DeadEnds = append(a.DeadEnds, u)
+		}
+
+		if u == start {
+			continue
+		}
+
+		switch a.InDegree[u] {
+		case 0:
+			a.Orphans = append(a.Orphans, u)
+		case 1:
+			a.SingleLink = append(a.SingleLink, u)
+		}
+	}
+
+	a.PageRank = getPageRank(nodes, adjacency)
+	if _, ok := a.InDegree[start]; ok {
+		a.ClickDepth = getClickDepths(adjacency, start)
+	}
+
+	for _, node := range nodes {
+		depth, ok := a.ClickDepth[CanonicalURL(node)]
+		if !ok {
+			a.Unreachable = append(a.Unreachable, CanonicalURL(node))
+			continue
+		}
+
+		for len(a.DepthDistribution) <= depth {
+			a.DepthDistribution = append(a.DepthDistribution, 0)
+		}
+		a.DepthDistribution[depth]++
+	}
+
+	a.Components = getComponents(nodes, adjacency)
+
+	return a
+}
+
+// AnalysisReport renders the given analysis as text: summary stats, the click depth distribution,
+// the top pages by PageRank and in-degree, and lists of the dead ends, orphans and pages linked only once.
+func AnalysisReport(a Analysis) (string, error) {
+	var buffer bytes.Buffer
+
+	w := func(format string, args ...interface{}) {
+		buffer.WriteString(fmt.Sprintf(format, args...))
+	}
+
+	links := 0
+	for _, d := range a.OutDegree {
+		links += d
+	}
+
+	largest := 0
+	cyclic := 0
+	for _, c := range a.Components {
+		if len(c) > largest {
+			largest = len(c)
+		}
+		if len(c) > 1 {
+			cyclic++
+		}
+	}
+
+	w("\nsummary:\n\n")
+	w("pages: %d\n", len(a.InDegree))
+	w("internal links: %d\n", links)
+	w("strongly connected components: %d (%d with more than one page, largest has %d pages)\n", len(a.Components), cyclic, largest)
+	w("dead ends: %d\n", len(a.DeadEnds))
+	w("orphans: %d\n", len(a.Orphans))
+	w("linked only once: %d\n", len(a.SingleLink))
+	w("unreachable from %s: %d\n", a.Start, len(a.Unreachable))
+
+	w("\nclick depth distribution:\n\n")
+	for depth, count := range a.DepthDistribution {
+		w("%d: %d\n", depth, count)
+	}
+
+	w("\ntop pages by PageRank:\n\n")
+	for _, u := range topPages(a.PageRank, 10) {
+		w("%.4f %s\n", a.PageRank[u], u)
+	}
+
+	inDegree := make(map[CanonicalURL]float64)
+	for u, d := range a.InDegree {
+		inDegree[u] = float64(d)
+	}
+
+	w("\ntop pages by inbound links:\n\n")
+	for _, u := range topPages(inDegree, 10) {
+		w("%d %s\n", a.InDegree[u], u)
+	}
+
+	for _, list := range []struct {
+		title string
+		pages []CanonicalURL
+	}{
+		{"dead ends", a.DeadEnds},
+		{"orphans", a.Orphans},
+		{"linked only once", a.SingleLink},
+		{"unreachable", a.Unreachable},
+	} {
+		w("\n%s:\n\n", list.title)
+		for _, u := range list.pages {
+			w("%s\n", u)
+		}
+		if len(list.pages) == 0 {
+			w("none\n")
+		}
+	}
+
+	return buffer.String(), nil
+}
+
+// getAdjacency returns the outgoing links of every page, without duplicates or self-links.
+// Pages which redirect to another page link to it, so that the pages only linked to through a redirect are reachable.
+func getAdjacency(s *Sitemap) map[CanonicalURL][]CanonicalURL {
+	adjacency := make(map[CanonicalURL][]CanonicalURL)
+
+	for _, e := range s.Edges() {
+		if e.From != e.To {
+			adjacency[e.From] = append(adjacency[e.From], e.To)
+		}
+	}
+
+	for _, n := range s.Nodes() {
+		if _, ok := s.Node(n.RedirectsTo); !ok || n.RedirectsTo == n.URL || linksTo(adjacency[n.URL], n.RedirectsTo) {
+			continue
+		}
+
+		adjacency[n.URL] = append(adjacency[n.URL], n.RedirectsTo)
+	}
+
+	return adjacency
+}
+
+// linksTo returns whether the given link targets include the given page.
+func linksTo(targets []CanonicalURL, u CanonicalURL) bool {
+	for _, target := range targets {
+		if target == u {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getPageRank computes the PageRank of every node using the power iteration method.
+// Pages with no outgoing links distribute their rank evenly across all the pages.
+func getPageRank(nodes []string, adjacency map[CanonicalURL][]CanonicalURL) map[CanonicalURL]float64 {
+	n := float64(len(nodes))
+	rank := make(map[CanonicalURL]float64)
+
+	for _, node := range nodes {
+		rank[CanonicalURL(node)] = 1 / n
+	}
+
+	for i := 0; i < PageRankIterations; i++ {
+		dangling := 0.0
+		for _, node := range nodes {
+			if len(adjacency[CanonicalURL(node)]) == 0 {
+				dangling += rank[CanonicalURL(node)]
+			}
+		}
+
+		next := make(map[CanonicalURL]float64)
+		for _, node := range nodes {
+			next[CanonicalURL(node)] = (1-PageRankDamping)/n + PageRankDamping*dangling/n
+		}
+
+		for _, node := range nodes {
+			u := CanonicalURL(node)
+			for _, target := range adjacency[u] {
+				next[target] += PageRankDamping * rank[u] / float64(len(adjacency[u]))
+			}
+		}
+
+		delta := 0.0
+		for u, r := range next {
+			delta += math.Abs(r - rank[u])
+		}
+
+		rank = next
+
+		if delta < PageRankTolerance {
+			break
+		}
+	}
+
+	return rank
+}
+
+// getClickDepths returns the min number of clicks to get to every page reachable from the start page.
+func getClickDepths(adjacency map[CanonicalURL][]CanonicalURL, start CanonicalURL) map[CanonicalURL]int {
+	depths := map[CanonicalURL]int{start: 0}
+	queue := []CanonicalURL{start}
+
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+
+		for _, target := range adjacency[u] {
+			if _, seen := depths[target]; !seen {
+				depths[target] = depths[u] + 1
+				queue = append(queue, target)
+			}
+		}
+	}
+
+	return depths
+}
+
+// getComponents returns the strongly connected components of the graph using Tarjan's algorithm, largest first.
+func getComponents(nodes []string, adjacency map[CanonicalURL][]CanonicalURL) [][]CanonicalURL {
+	index := 0
+	indices := make(map[CanonicalURL]int)
+	lowlinks := make(map[CanonicalURL]int)
+	onStack := make(map[CanonicalURL]bool)
+	var stack []CanonicalURL
+	var components [][]CanonicalURL
+
+	var connect func(u CanonicalURL)
+	connect = func(u CanonicalURL) {
+		indices[u] = index
+		lowlinks[u] = index
+		index++
+		stack = append(stack, u)
+		onStack[u] = true
+
+		for _, v := range adjacency[u] {
+			if _, visited := indices[v]; !visited {
+				connect(v)
+				if lowlinks[v] < lowlinks[u] {
+					lowlinks[u] = lowlinks[v]
+				}
+			} else if onStack[v] && indices[v] < lowlinks[u] {
+				lowlinks[u] = indices[v]
+			}
+		}
+
+		if lowlinks[u] == indices[u] {
+			var component []CanonicalURL
+			for {
+				v := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[v] = false
+				component = append(component, v)
+				if v == u {
+					break
+				}
+			}
+
+			sort.Slice(component, func(i, j int) bool { return component[i] < component[j] })
+			components = append(components, component)
+		}
+	}
+
+	for _, node := range nodes {
+		if _, visited := indices[CanonicalURL(node)]; !visited {
+			connect(CanonicalURL(node))
+		}
+	}
+
+	sort.SliceStable(components, func(i, j int) bool {
+		if len(components[i]) != len(components[j]) {
+			return len(components[i]) > len(components[j])
+		}
+		return components[i][0] < components[j][0]
+	})
+
+	return components
+}
+
+// topPages returns up to n pages with the highest values, sorted by value and then by URL.
+func topPages(values map[CanonicalURL]float64, n int) []CanonicalURL {
+	var pages []CanonicalURL
+	for u := range values {
+		pages = append(pages, u)
+	}
+
+	sort.Slice(pages, func(i, j int) bool {
+		if values[pages[i]] != values[pages[j]] {
+			return values[pages[i]] > values[pages[j]]
+		}
+		return pages[i] < pages[j]
+	})
+
+	if len(pages) > n {
+		pages = pages[:n]
+	}
+
+	return pages
+}
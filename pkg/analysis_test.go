@@ -0,0 +1,148 @@
+package crawler
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAnalyse(t *testing.T) {
+	s := getTestSitemap()
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com/orphan"), Links: Links{"https://test.com/foo"}})
+
+	a := Analyse(s, CanonicalURL("https://test.com"))
+
+	expectedIn := map[CanonicalURL]int{
+		"https://test.com":        0,
+		"https://test.com/foo":    3,
+		"https://test.com/bar":    2,
+		"https://test.com/baz":    1,
+		"https://test.com/orphan": 0,
+	}
+
+	for u, d := range expectedIn {
+		if a.InDegree[u] != d {
+			t.Errorf("Analyse(): expected in-degree of %s to be %d, got %d", u, d, a.InDegree[u])
+		}
+	}
+
+	if a.OutDegree["https://test.com"] != 2 {
+		t.Errorf("Analyse(): expected out-degree of https://test.com to be 2 (ignoring the self-link), got %d", a.OutDegree["https://test.com"])
+	}
+
+	expectedDepths := map[CanonicalURL]int{
+		"https://test.com":     0,
+		"https://test.com/foo": 1,
+		"https://test.com/bar": 1,
+		"https://test.com/baz": 2,
+	}
+
+	if len(a.ClickDepth) != len(expectedDepths) {
+		t.Errorf("Analyse(): expected click depths %v, got %v", expectedDepths, a.ClickDepth)
+	}
+
+	for u, d := range expectedDepths {
+		if a.ClickDepth[u] != d {
+			t.Errorf("Analyse(): expected click depth of %s to be %d, got %d", u, d, a.ClickDepth[u])
+		}
+	}
+
+	if len(a.DepthDistribution) != 3 || a.DepthDistribution[0] != 1 || a.DepthDistribution[1] != 2 || a.DepthDistribution[2] != 1 {
+		t.Errorf("Analyse(): expected depth distribution [1 2 1], got %v", a.DepthDistribution)
+	}
+
+	assertPages(t, "Unreachable", a.Unreachable, "https://test.com/orphan")
+	assertPages(t, "DeadEnds", a.DeadEnds, "https://test.com/baz")
+	assertPages(t, "Orphans", a.Orphans, "https://test.com/orphan")
+	assertPages(t, "SingleLink", a.SingleLink, "https://test.com/baz")
+
+	if len(a.Components) != 4 {
+		t.Errorf("Analyse(): expected 4 components, got %v", a.Components)
+		t.FailNow()
+	}
+
+	assertPages(t, "Components[0]", a.Components[0], "https://test.com/bar", "https://test.com/foo")
+
+	total := 0.0
+	for _, r := range a.PageRank {
+		total += r
+	}
+
+	if math.Abs(total-1) > 1e-6 {
+		t.Errorf("Analyse(): expected PageRank values to add up to 1, got %f", total)
+	}
+
+	if a.PageRank["https://test.com/foo"] <= a.PageRank["https://test.com/orphan"] {
+		t.Errorf("Analyse(): expected https://test.com/foo to rank higher than an orphan, got %v", a.PageRank)
+	}
+}
+
+func TestAnalyseFollowsRedirects(t *testing.T) {
+	s := NewSitemap()
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com"), Links: Links{"https://test.com/old"}})
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com/new"), Links: Links{"https://test.com"}, RedirectedFrom: "https://test.com/old", Depth: 1})
+
+	a := Analyse(s, CanonicalURL("https://test.com"))
+
+	if a.InDegree["https://test.com/new"] != 1 || a.OutDegree["https://test.com/old"] != 1 {
+		t.Errorf("Analyse(): expected the redirect to count as a link from /old to /new, got %v and %v", a.InDegree, a.OutDegree)
+	}
+
+	if d, ok := a.ClickDepth["https://test.com/new"]; !ok || d != 2 {
+		t.Errorf("Analyse(): expected https://test.com/new to be reachable at depth 2 through the redirect, got %v", a.ClickDepth)
+	}
+
+	assertPages(t, "Orphans", a.Orphans)
+	assertPages(t, "Unreachable", a.Unreachable)
+	assertPages(t, "DeadEnds", a.DeadEnds)
+}
+
+func TestAnalyseWithUnknownStart(t *testing.T) {
+	a := Analyse(getTestSitemap(), CanonicalURL("https://other.com"))
+
+	if len(a.ClickDepth) != 0 {
+		t.Errorf("Analyse(): expected no click depths, got %v", a.ClickDepth)
+	}
+
+	if len(a.Unreachable) != 4 {
+		t.Errorf("Analyse(): expected all 4 pages to be unreachable, got %v", a.Unreachable)
+	}
+}
+
+func TestAnalysisReport(t *testing.T) {
+	actual, err := AnalysisReport(Analyse(getTestSitemap(), CanonicalURL("https://test.com")))
+	if err != nil {
+		t.Errorf("AnalysisReport(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expectedLines := []string{
+		"pages: 4",
+		"internal links: 5",
+		"strongly connected components: 3 (1 with more than one page, largest has 2 pages)",
+		"dead ends: 1",
+		"click depth distribution:",
+		"top pages by PageRank:",
+		"2 https://test.com/foo",
+	}
+
+	for _, ll := range expectedLines {
+		if !strings.Contains(actual, ll) {
+			t.Errorf("AnalysisReport(): expected output %s to contain line %s", actual, ll)
+		}
+	}
+}
+
+func assertPages(t *testing.T, name string, actual []CanonicalURL, expected ...CanonicalURL) {
+	if len(actual) != len(expected) {
+		t.Errorf("Analyse(): expected %s to be %v, got %v", name, expected, actual)
+		return
+	}
+
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Analyse(): expected %s to be %v, got %v", name, expected, actual)
+			return
+		}
+	}
+}
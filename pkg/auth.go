@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credentials are sent with every request to a single host.
+// Username and Password are sent using basic auth, and BearerToken in an Authorization header
+// (taking precedence over basic auth if both are set). Headers are extra request headers, e.g. an API key.
+type Credentials struct {
+	Username    string
+	Password    string
+	BearerToken string
+	Headers     map[string]string
+}
+
+// authTransport adds the credentials of the requested host to every request.
+// Requests to hosts with no credentials are sent as they are, so credentials never leak to other hosts.
+type authTransport struct {
+	base        http.RoundTripper
+	credentials map[string]Credentials
+}
+
+func (t authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Credentials for the host name apply to any port, and credentials for the host and port are applied on top.
+	var matches []Credentials
+	for _, key := range []string{req.URL.Hostname(), req.URL.Host} {
+		if creds, ok := t.credentials[key]; ok {
+			matches = append(matches, creds)
+		}
+		if req.URL.Port() == "" {
+			break
+		}
+	}
+
+	if len(matches) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	// Round trippers mustn't modify the request they're given.
+	req = req.Clone(req.Context())
+
+	for _, creds := range matches {
+		if creds.Username != "" || creds.Password != "" {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+
+		if creds.BearerToken != "" {
+			req.Header.Set("Authorization", "Bearer "+creds.BearerToken)
+		}
+
+		for name, value := range creds.Headers {
+			req.Header.Set(name, value)
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// LoadCookieFile returns a cookie jar holding the cookies in the given Netscape cookies file,
+// the format used by curl and most browser cookie export extensions:
+//
+//	# domain  include subdomains  path  secure  expiry  name  value
+//	.example.com	TRUE	/	TRUE	1893456000	session	abc123
+//
+// Lines starting with #HttpOnly_ hold HTTP-only cookies. Expired cookies are ignored, and an expiry of 0
+// means a session cookie. The jar only sends cookies to the domains they belong to.
+func LoadCookieFile(file string) (http.CookieJar, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error opening the cookie file: %s", err.Error())
+	}
+
+	defer f.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the cookie jar: %s", err.Error())
+	}
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+
+		httpOnly := strings.HasPrefix(text, "#HttpOnly_")
+		text = strings.TrimPrefix(text, "#HttpOnly_")
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("error reading the cookie file %s: line %d: expected 7 tab-separated fields, got %d", file, line, len(fields))
+		}
+
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the cookie file %s: line %d: invalid expiry %q", file, line, fields[4])
+		}
+
+		host := strings.TrimPrefix(fields[0], ".")
+		secure := fields[3] == "TRUE"
+
+		c := &http.Cookie{Name: fields[5], Value: fields[6], Path: fields[2], Secure: secure, HttpOnly: httpOnly}
+
+		if expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+			if c.Expires.Before(time.Now()) {
+				continue
+			}
+		}
+
+		// Cookies which include subdomains are domain cookies, the others are only sent to the exact host.
+		if fields[1] == "TRUE" {
+			c.Domain = host
+		}
+
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: fields[2]}, []*http.Cookie{c})
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error reading the cookie file %s: %s", file, err.Error())
+	}
+
+	return jar, nil
+}
@@ -0,0 +1,160 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSendsCredentials(t *testing.T) {
+	var tests = []struct {
+		creds    Credentials
+		header   string
+		expected string
+	}{
+		{Credentials{Username: "admin", Password: "secret"}, "Authorization", "Basic YWRtaW46c2VjcmV0"},
+		{Credentials{Username: "admin", Password: "secret", BearerToken: "token"}, "Authorization", "Bearer token"},
+		{Credentials{Headers: map[string]string{"X-Api-Key": "key"}}, "X-Api-Key", "key"},
+	}
+
+	for _, test := range tests {
+		var actual string
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actual = r.Header.Get(test.header)
+		}))
+
+		u, _ := url.Parse(ts.URL)
+
+		p := NewParser(u.Scheme, u.Host)
+		p.SetFetchOptions(FetchOptions{Credentials: map[string]Credentials{u.Host: test.creds}})
+
+		_, err := p.parse(context.TODO(), ts.URL)
+		if err != nil {
+			t.Errorf("parse(): expected no error returned, got %s", err.Error())
+		}
+
+		if actual != test.expected {
+			t.Errorf("parse(): expected %s header %q, got %q", test.header, test.expected, actual)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestCredentialsAreScopedPerHost(t *testing.T) {
+	var auth, env string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		env = r.Header.Get("X-Env")
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+
+	transport := authTransport{
+		base: http.DefaultTransport,
+		credentials: map[string]Credentials{
+			"127.0.0.1:1":      {BearerToken: "other port"},
+			"staging.test.com": {BearerToken: "other host"},
+		},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	_, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Errorf("RoundTrip(): expected no error returned, got %s", err.Error())
+	}
+
+	if auth != "" {
+		t.Errorf("RoundTrip(): expected no credentials to be sent to %s, got %q", u.Host, auth)
+	}
+
+	// Credentials keyed by host name only are sent to any port, and credentials keyed by host and port are added to them.
+	transport.credentials[u.Hostname()] = Credentials{BearerToken: "host", Headers: map[string]string{"X-Env": "staging"}}
+	transport.credentials[u.Host] = Credentials{Headers: map[string]string{"X-Env": "port"}}
+
+	req, _ = http.NewRequest(http.MethodGet, ts.URL, nil)
+	_, err = transport.RoundTrip(req)
+	if err != nil {
+		t.Errorf("RoundTrip(): expected no error returned, got %s", err.Error())
+	}
+
+	if auth != "Bearer host" || env != "port" || req.Header.Get("Authorization") != "" {
+		t.Errorf("RoundTrip(): expected the credentials to be sent without changing the request, got %q and %q", auth, env)
+	}
+}
+
+func TestLoadCookieFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-cookies")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "cookies.txt")
+	ioutil.WriteFile(file, []byte(
+		"# Netscape HTTP Cookie File\n\n"+
+			"127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tabc\n"+
+			"#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t4102444800\tsso\tdef\n"+
+			"127.0.0.1\tFALSE\t/\tFALSE\t1\texpired\tghi\n"+
+			".other.com\tTRUE\t/\tFALSE\t0\tother\tjkl\n"), 0644)
+
+	jar, err := LoadCookieFile(file)
+	if err != nil {
+		t.Errorf("LoadCookieFile(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	var cookies string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookies = r.Header.Get("Cookie")
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+
+	p := NewParser(u.Scheme, u.Host)
+	p.SetFetchOptions(FetchOptions{Jar: jar})
+	p.parse(context.TODO(), ts.URL)
+
+	if cookies != "session=abc; sso=def" {
+		t.Errorf("LoadCookieFile(): expected the unexpired cookies for %s to be sent, got %q", u.Host, cookies)
+	}
+
+	other := jar.Cookies(&url.URL{Scheme: "http", Host: "www.other.com", Path: "/"})
+	if len(other) != 1 || other[0].Value != "jkl" {
+		t.Errorf("LoadCookieFile(): expected the domain cookie to be sent to subdomains, got %v", other)
+	}
+}
+
+func TestLoadCookieFileReturnsErrorsForMalformedLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-cookies")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	for i, content := range []string{"test.com\tFALSE\t/\n", "test.com\tFALSE\t/\tFALSE\tnever\tname\tvalue\n"} {
+		file := filepath.Join(dir, fmt.Sprintf("cookies%d.txt", i))
+		ioutil.WriteFile(file, []byte(content), 0644)
+
+		_, err := LoadCookieFile(file)
+		if err == nil {
+			t.Errorf("LoadCookieFile(%q): expected an error returned", content)
+		}
+	}
+
+	_, err = LoadCookieFile(filepath.Join(dir, "missing.txt"))
+	if err == nil {
+		t.Error("LoadCookieFile(missing file): expected an error returned")
+	}
+}
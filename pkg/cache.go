@@ -0,0 +1,268 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCacheTTL is how long cached responses are served by default before the pages are fetched again.
+const DefaultCacheTTL = 24 * time.Hour
+
+// ErrNotCached is returned when offline for requests whose responses aren't in the cache.
+var ErrNotCached = errors.New("response not cached (offline)")
+
+// Cache stores the responses to the requests made while crawling on disk, and serves them again instead of fetching
+// the pages, e.g. to iterate on output formats without hitting the site every time. It sits beneath the Parser,
+// which parses cached responses the same way as fetched ones.
+//
+// Responses to GET requests are keyed by URL and request headers (including credentials, which are hashed), and saved
+// as one JSON file each. Cookies aren't part of the key, as the session they hold changes with every login: pages
+// cached while logged in are served to any session. Responses are saved with as much of their body as was read, which
+// is all of it for HTML pages smaller than the max body size. Only HTML pages are parsed, so other resources are saved
+// without their body, along with their size. Server errors and 429 responses aren't cached, as they're usually
+// transient. The requests made to log in bypass the cache, and the Parser doesn't log in when offline.
+type Cache struct {
+	dir     string
+	ttl     time.Duration
+	offline bool
+	hits    int64
+	misses  int64
+}
+
+// CacheStats counts the responses served from the cache (Hits), and the ones which had to be fetched (Misses).
+type CacheStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// cacheEntry is a response saved in the cache. ContentLength is the length of the body sent by the server, which
+// may be longer than the part of it saved.
+type cacheEntry struct {
+	URL           string      `json:"url"`
+	Time          time.Time   `json:"time"`
+	Status        int         `json:"status"`
+	Header        http.Header `json:"header"`
+	ContentLength int64       `json:"contentLength"`
+	Body          []byte      `json:"body"`
+}
+
+// NewCache returns a Cache saving responses in the given directory, which is created if it doesn't exist.
+// Cached responses are served until they're older than the given TTL (0 for no expiry). When offline, every request
+// is served from the cache regardless of the TTL, and fails with ErrNotCached if its response isn't in it.
+func NewCache(dir string, ttl time.Duration, offline bool) (*Cache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the cache directory %s: %s", dir, err.Error())
+	}
+
+	return &Cache{dir: dir, ttl: ttl, offline: offline}, nil
+}
+
+// Stats returns the number of responses served from the cache and fetched so far. It's safe to call while crawling.
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{Hits: atomic.LoadInt64(&c.hits), Misses: atomic.LoadInt64(&c.misses)}
+}
+
+// load returns the cached response with the given key.
+func (c *Cache) load(key string) (cacheEntry, error) {
+	var e cacheEntry
+
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return e, err
+	}
+
+	err = json.Unmarshal(b, &e)
+	if err != nil {
+		return e, fmt.Errorf("error decoding the cached response %s: %s", key, err.Error())
+	}
+
+	return e, nil
+}
+
+// save saves the given response in the cache. It's written to a temporary file first, so that a response being saved
+// is never read half-written.
+func (c *Cache) save(key string, e cacheEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error encoding the response to %s: %s", e.URL, err.Error())
+	}
+
+	f, err := ioutil.TempFile(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating the cache file: %s", err.Error())
+	}
+
+	_, err = f.Write(b)
+	f.Close()
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(c.dir, key+".json"))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("error saving the response to %s: %s", e.URL, err.Error())
+	}
+
+	return nil
+}
+
+// isOffline returns whether the cache serves every request, without fetching anything. It's false for a nil Cache.
+func (c *Cache) isOffline() bool {
+	return c != nil && c.offline
+}
+
+// fresh returns whether the given cached response can be served.
+func (c *Cache) fresh(e cacheEntry) bool {
+	return c.offline || c.ttl <= 0 || time.Since(e.Time) < c.ttl
+}
+
+// cacheKey returns the key of the response to the given request, a hash of its method, URL and headers other than
+// the cookies.
+func cacheKey(req *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL.String())
+
+	var names []string
+	for name := range req.Header {
+		if name != "Cookie" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			fmt.Fprintf(h, "%s: %s\n", name, value)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheTransport serves responses from the cache, fetching (and caching) the ones which aren't in it.
+type cacheTransport struct {
+	base  http.RoundTripper
+	cache *Cache
+}
+
+func (t cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		if t.cache.offline {
+			return nil, ErrNotCached
+		}
+		return t.base.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+
+	e, err := t.cache.load(key)
+	if err == nil && t.cache.fresh(e) {
+		atomic.AddInt64(&t.cache.hits, 1)
+		return e.response(req), nil
+	}
+
+	atomic.AddInt64(&t.cache.misses, 1)
+
+	if t.cache.offline {
+		return nil, ErrNotCached
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return resp, nil
+	}
+
+	e = cacheEntry{URL: req.URL.String(), Time: time.Now(), Status: resp.StatusCode, Header: resp.Header.Clone(),
+		ContentLength: resp.ContentLength}
+	resp.Body = &cachingBody{body: resp.Body, cache: t.cache, key: key, entry: e, discard: !parsed(resp.Header)}
+
+	return resp, nil
+}
+
+// response returns the cached response as the response to the given request.
+func (e cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		ContentLength: e.ContentLength,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		Request:       req,
+	}
+}
+
+// parsed returns whether the Parser may parse the body of a response with the given headers: HTML pages, and responses
+// whose content type has to be sniffed.
+func parsed(header http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType == "" || mediaType == "application/octet-stream" || isHTML(mediaType)
+}
+
+// cachingBody saves the response in the cache once its body is closed, along with the part of the body read unless
+// discard is set. Responses whose body couldn't be read, e.g. because of a timeout, aren't saved.
+type cachingBody struct {
+	body    io.ReadCloser
+	cache   *Cache
+	key     string
+	entry   cacheEntry
+	read    bytes.Buffer
+	n       int64
+	discard bool
+	failed  bool
+	closed  bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.n += int64(n)
+	if !b.discard {
+		b.read.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		// The whole body was read, so its length is known even if the server didn't send it.
+		b.entry.ContentLength = b.n
+	} else if err != nil {
+		b.failed = true
+	}
+
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	err := b.body.Close()
+
+	if !b.failed && !b.closed {
+		b.entry.Body = b.read.Bytes()
+
+		saveErr := b.cache.save(b.key, b.entry)
+		if saveErr != nil {
+			log.Printf("caching the response returned an error: %s", saveErr.Error())
+		}
+	}
+
+	b.closed = true
+
+	return err
+}
@@ -0,0 +1,259 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func getCachedSite() (*int64, *httptest.Server) {
+	var requests int64
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<title>Home</title><a href="/doc.pdf">doc</a><a href="/old">old</a>`)
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Length", "1000")
+			w.Write(make([]byte, 1000))
+		case "/old":
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	return &requests, ts
+}
+
+func getTestCache(t *testing.T, ttl time.Duration, offline bool) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "crawler-cache")
+	if err != nil {
+		t.Fatalf("couldn't create a temporary directory: %s", err.Error())
+	}
+
+	cache, err := NewCache(dir, ttl, offline)
+	if err != nil {
+		t.Fatalf("NewCache(): expected no error returned, got %s", err.Error())
+	}
+
+	return cache, func() { os.RemoveAll(dir) }
+}
+
+func parseWith(u string, o FetchOptions) (Page, error) {
+	tsURL, _ := url.Parse(u)
+
+	p := NewParser(tsURL.Scheme, tsURL.Host)
+	p.SetFetchOptions(o)
+
+	// Links are sorted, so that pages can be compared.
+	page, err := p.parse(context.TODO(), u)
+	sort.Strings(page.Links)
+
+	return page, err
+}
+
+func TestCacheServesResponses(t *testing.T) {
+	requests, ts := getCachedSite()
+	defer ts.Close()
+
+	cache, cleanup := getTestCache(t, DefaultCacheTTL, false)
+	defer cleanup()
+
+	for _, path := range []string{"/", "/doc.pdf", "/old"} {
+		fetched, err := parseWith(ts.URL+path, FetchOptions{Cache: cache})
+		if err != nil {
+			t.Errorf("parse(%s): expected no error returned, got %s", path, err.Error())
+			t.FailNow()
+		}
+
+		n := atomic.LoadInt64(requests)
+
+		cached, err := parseWith(ts.URL+path, FetchOptions{Cache: cache})
+		if err != nil {
+			t.Errorf("parse(%s): expected no error returned from the cache, got %s", path, err.Error())
+			t.FailNow()
+		}
+
+		if atomic.LoadInt64(requests) != n {
+			t.Errorf("parse(%s): expected the response to be served from the cache, got %d more request(s)", path, atomic.LoadInt64(requests)-n)
+		}
+
+		if fmt.Sprint(cached) != fmt.Sprint(fetched) {
+			t.Errorf("parse(%s): expected the cached page to be the same as the fetched one %v, got %v", path, fetched, cached)
+		}
+	}
+
+	// The redirect is cached, along with the page it redirects to, which is requested with a Referer header so it's
+	// cached separately from the home page.
+	if stats := cache.Stats(); stats.Hits != 4 || stats.Misses != 4 {
+		t.Errorf("Stats(): expected 4 hits and 4 misses, got %v", stats)
+	}
+}
+
+func TestCacheKeysResponsesByHeaders(t *testing.T) {
+	requests, ts := getCachedSite()
+	defer ts.Close()
+
+	cache, cleanup := getTestCache(t, DefaultCacheTTL, false)
+	defer cleanup()
+
+	for _, o := range []FetchOptions{{Cache: cache}, {Cache: cache, UserAgent: "test-bot"}, {Cache: cache, UserAgent: "test-bot"}} {
+		_, err := parseWith(ts.URL, o)
+		if err != nil {
+			t.Errorf("parse(): expected no error returned, got %s", err.Error())
+			t.FailNow()
+		}
+	}
+
+	if atomic.LoadInt64(requests) != 2 {
+		t.Errorf("parse(): expected a request for each User-Agent, got %d", atomic.LoadInt64(requests))
+	}
+}
+
+func TestCacheSkipsBodiesOfResources(t *testing.T) {
+	_, ts := getCachedSite()
+	defer ts.Close()
+
+	cache, cleanup := getTestCache(t, DefaultCacheTTL, false)
+	defer cleanup()
+
+	for _, path := range []string{"/", "/doc.pdf"} {
+		parseWith(ts.URL+path, FetchOptions{Cache: cache})
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cache.dir, "*.json"))
+	if len(files) != 2 {
+		t.Errorf("parse(): expected 2 cached responses, got %v", files)
+		t.FailNow()
+	}
+
+	for _, file := range files {
+		e, err := cache.load(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			t.Errorf("load(): expected no error returned, got %s", err.Error())
+			t.FailNow()
+		}
+
+		html := !strings.HasSuffix(e.URL, ".pdf")
+		if html != (len(e.Body) > 0) || (!html && e.ContentLength != 1000) {
+			t.Errorf("parse(): expected only the body of the HTML page to be cached, got %d bytes out of %d for %s", len(e.Body), e.ContentLength, e.URL)
+		}
+	}
+}
+
+func TestCacheWithLogin(t *testing.T) {
+	site, ts := getLoginSite(t)
+	defer ts.Close()
+
+	cache, cleanup := getTestCache(t, DefaultCacheTTL, false)
+	defer cleanup()
+
+	login := &Login{Page: ts.URL + "/login", Form: map[string]string{"username": "admin", "password": "secret"}}
+
+	// Every login gets a new session, while the pages are served from the cache whichever session they're requested with.
+	for i := 0; i < 2; i++ {
+		page, err := parseWith(ts.URL+"/", FetchOptions{Cache: cache, Login: login})
+		if err != nil || len(page.Links) != 1 {
+			t.Errorf("parse(): expected the page to be fetched after logging in, got %v and %v", page, err)
+		}
+	}
+
+	if stats := cache.Stats(); site.logins != 2 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("parse(): expected 2 logins bypassing the cache and the page cached once, got %d and %v", site.logins, stats)
+	}
+
+	offline, err := NewCache(cache.dir, DefaultCacheTTL, true)
+	if err != nil {
+		t.Errorf("NewCache(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	page, err := parseWith(ts.URL+"/", FetchOptions{Cache: offline, Login: login})
+	if err != nil || len(page.Links) != 1 || site.logins != 2 {
+		t.Errorf("parse(): expected the page to be served from the cache without logging in when offline, got %v and %v", page, err)
+	}
+}
+
+func TestCacheExpiresResponses(t *testing.T) {
+	requests, ts := getCachedSite()
+	defer ts.Close()
+
+	cache, cleanup := getTestCache(t, time.Nanosecond, false)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		parseWith(ts.URL, FetchOptions{Cache: cache})
+	}
+
+	if atomic.LoadInt64(requests) != 2 {
+		t.Errorf("parse(): expected expired responses to be fetched again, got %d request(s)", atomic.LoadInt64(requests))
+	}
+}
+
+func TestCacheSkipsServerErrors(t *testing.T) {
+	requests, ts := getCachedSite()
+	defer ts.Close()
+
+	cache, cleanup := getTestCache(t, DefaultCacheTTL, false)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		parseWith(ts.URL+"/unavailable", FetchOptions{Cache: cache})
+	}
+
+	if atomic.LoadInt64(requests) != 2 {
+		t.Errorf("parse(): expected server errors not to be cached, got %d request(s)", atomic.LoadInt64(requests))
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	_, ts := getCachedSite()
+
+	cache, cleanup := getTestCache(t, time.Nanosecond, false)
+	defer cleanup()
+
+	expected, err := parseWith(ts.URL, FetchOptions{Cache: cache})
+	if err != nil {
+		t.Errorf("parse(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	ts.Close()
+
+	// Offline, expired responses are served too.
+	offline, err := NewCache(cache.dir, time.Nanosecond, true)
+	if err != nil {
+		t.Errorf("NewCache(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	actual, err := parseWith(ts.URL, FetchOptions{Cache: offline})
+	if err != nil {
+		t.Errorf("parse(): expected the page to be served from the cache, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("parse(): expected the cached page %v, got %v", expected, actual)
+	}
+
+	_, err = parseWith(ts.URL+"/doc.pdf", FetchOptions{Cache: offline})
+	if !errors.Is(err, ErrNotCached) || !strings.Contains(err.Error(), "offline") {
+		t.Errorf("parse(): expected %s for a page which isn't cached, got %v", ErrNotCached.Error(), err)
+	}
+}
@@ -0,0 +1,324 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PathMapping maps the pages under a path on the left side of a comparison to the pages under another path on the right,
+// e.g. From "/en" and To "/" if the site is served under /en on the left only.
+type PathMapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Comparison holds the differences between crawls of two deployments of the same site, e.g. staging and production.
+// Pages are identified by their path relative to the base URL of their side, with the path mappings applied to the
+// paths on the left, so all the paths are given as they are on the right.
+// Links are only compared for pages which were crawled on both sides, and content hashes for HTML pages.
+// Collisions holds the pages on the left which the path mappings map to the same path, keyed by that path: only the
+// first of them (by URL) is compared, so they're reported along with the differences.
+type Comparison struct {
+	Left               string              `json:"left"`
+	Right              string              `json:"right"`
+	MissingLeft        []string            `json:"missingLeft"`
+	MissingRight       []string            `json:"missingRight"`
+	LinksOnlyLeft      map[string][]string `json:"linksOnlyLeft"`
+	LinksOnlyRight     map[string][]string `json:"linksOnlyRight"`
+	StatusDifferences  []PathDifference    `json:"statusDifferences"`
+	ContentDifferences []PathDifference    `json:"contentDifferences"`
+	Collisions         map[string][]string `json:"collisions"`
+}
+
+// PathDifference describes a page which differs between the two sides of a comparison, e.g. their status or content hash.
+type PathDifference struct {
+	Path  string `json:"path"`
+	Left  string `json:"left"`
+	Right string `json:"right"`
+}
+
+// comparedSide holds the pages of one side of a comparison, keyed by path, along with the URLs of the pages whose
+// paths collide.
+type comparedSide struct {
+	sitemap    *Sitemap
+	base       string
+	mappings   []PathMapping
+	pages      map[string]Node
+	collisions map[string][]string
+}
+
+// Compare compares crawls of two deployments of the same site, whose base URLs are the starting URLs of the crawls.
+// It returns the pages missing on either side, along with the links, statuses and contents which differ between them.
+// Pages and links outside the base URLs are left out of the comparison.
+func Compare(left Snapshot, right Snapshot, mappings []PathMapping) (Comparison, error) {
+	l, err := newComparedSide(left, mappings)
+	if err != nil {
+		return Comparison{}, err
+	}
+
+	r, err := newComparedSide(right, nil)
+	if err != nil {
+		return Comparison{}, err
+	}
+
+	c := Comparison{
+		Left:               l.base,
+		Right:              r.base,
+		MissingLeft:        []string{},
+		MissingRight:       []string{},
+		LinksOnlyLeft:      make(map[string][]string),
+		LinksOnlyRight:     make(map[string][]string),
+		StatusDifferences:  []PathDifference{},
+		ContentDifferences: []PathDifference{},
+		Collisions:         l.collisions,
+	}
+
+	for _, path := range sortedPaths(r.pages) {
+		if _, ok := l.pages[path]; !ok {
+			c.MissingLeft = append(c.MissingLeft, path)
+		}
+	}
+
+	for _, path := range sortedPaths(l.pages) {
+		leftNode := l.pages[path]
+
+		rightNode, ok := r.pages[path]
+		if !ok {
+			c.MissingRight = append(c.MissingRight, path)
+			continue
+		}
+
+		leftStatus, rightStatus := statusText(leftNode), statusText(rightNode)
+		if leftStatus != rightStatus {
+			c.StatusDifferences = append(c.StatusDifferences, PathDifference{Path: path, Left: leftStatus, Right: rightStatus})
+		}
+
+		if leftNode.Hash != "" && rightNode.Hash != "" && leftNode.Hash != rightNode.Hash {
+			c.ContentDifferences = append(c.ContentDifferences, PathDifference{Path: path, Left: leftNode.Hash, Right: rightNode.Hash})
+		}
+
+		if !leftNode.Crawled || !rightNode.Crawled {
+			continue
+		}
+
+		onlyRight, onlyLeft := diffLinks(l.links(leftNode.URL), r.links(rightNode.URL))
+		if len(onlyLeft) > 0 {
+			c.LinksOnlyLeft[path] = onlyLeft
+		}
+		if len(onlyRight) > 0 {
+			c.LinksOnlyRight[path] = onlyRight
+		}
+	}
+
+	return c, nil
+}
+
+// Empty returns true if the two crawls compared have no differences.
+func (c Comparison) Empty() bool {
+	return len(c.MissingLeft)+len(c.MissingRight)+len(c.LinksOnlyLeft)+len(c.LinksOnlyRight)+len(c.StatusDifferences)+
+		len(c.ContentDifferences)+len(c.Collisions) == 0
+}
+
+// ComparisonText renders the given comparison as text, listing every type of difference.
+func ComparisonText(c Comparison) (string, error) {
+	var buffer bytes.Buffer
+
+	_, err := buffer.WriteString(fmt.Sprintf("left:  %s\nright: %s\n", c.Left, c.Right))
+	if err != nil {
+		return "", fmt.Errorf("error generating the comparison output: %s", err.Error())
+	}
+
+	sections := []struct {
+		title string
+		lines []string
+	}{
+		{"missing on the left", pathsToLines("+ ", c.MissingLeft)},
+		{"missing on the right", pathsToLines("- ", c.MissingRight)},
+		{"links only on the left", pathLinksToLines("- ", c.LinksOnlyLeft)},
+		{"links only on the right", pathLinksToLines("+ ", c.LinksOnlyRight)},
+		{"status differences", statusDifferencesToLines(c.StatusDifferences)},
+		{"content differences", contentDifferencesToLines(c.ContentDifferences)},
+		{"path collisions on the left", collisionsToLines(c.Collisions)},
+	}
+
+	for _, section := range sections {
+		_, err := buffer.WriteString(fmt.Sprintf("\n%s (%d):\n\n", section.title, len(section.lines)))
+		if err != nil {
+			return "", fmt.Errorf("error generating the comparison output: %s", err.Error())
+		}
+
+		for _, line := range section.lines {
+			_, err := buffer.WriteString(line + "\n")
+			if err != nil {
+				return "", fmt.Errorf("error writing the %s: %s", section.title, err.Error())
+			}
+		}
+	}
+
+	return buffer.String(), nil
+}
+
+// ComparisonJSON renders the given comparison as indented JSON.
+func ComparisonJSON(c Comparison) (string, error) {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error generating the comparison JSON: %s", err.Error())
+	}
+
+	return string(b), nil
+}
+
+func newComparedSide(snap Snapshot, mappings []PathMapping) (comparedSide, error) {
+	u, err := url.Parse(snap.Start)
+	if err != nil {
+		return comparedSide{}, fmt.Errorf("error parsing the base URL %s: %s", snap.Start, err.Error())
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return comparedSide{}, fmt.Errorf("invalid base URL %q: a full URL including the protocol is required", snap.Start)
+	}
+
+	side := comparedSide{
+		sitemap:    snap.Sitemap,
+		base:       fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, strings.TrimRight(u.Path, "/")),
+		pages:      make(map[string]Node),
+		collisions: make(map[string][]string),
+	}
+
+	// Mappings are applied to paths without a trailing slash, which is how they're saved in the sitemap.
+	for _, m := range mappings {
+		side.mappings = append(side.mappings, PathMapping{From: strings.TrimRight(m.From, "/"), To: strings.TrimRight(m.To, "/")})
+	}
+
+	// Nodes are sorted by URL, so the first page mapped to a path is the one compared if several are.
+	for _, n := range snap.Sitemap.Nodes() {
+		path, ok := side.path(n.URL)
+		if !ok || !fetched(n) {
+			continue
+		}
+
+		first, ok := side.pages[path]
+		if !ok {
+			side.pages[path] = n
+			continue
+		}
+
+		if len(side.collisions[path]) == 0 {
+			side.collisions[path] = []string{string(first.URL)}
+		}
+		side.collisions[path] = append(side.collisions[path], string(n.URL))
+	}
+
+	return side, nil
+}
+
+// path returns the path of the given page relative to the base URL, with the first matching mapping applied to it,
+// or false if the page isn't under the base URL. The base URL itself has the path "/".
+func (side comparedSide) path(u CanonicalURL) (string, bool) {
+	s := string(u)
+	if s != side.base && !strings.HasPrefix(s, side.base+"/") {
+		return "", false
+	}
+
+	path := strings.TrimPrefix(s, side.base)
+
+	for _, m := range side.mappings {
+		if path == m.From || strings.HasPrefix(path, m.From+"/") {
+			path = m.To + strings.TrimPrefix(path, m.From)
+			break
+		}
+	}
+
+	if path == "" {
+		return "/", true
+	}
+
+	return path, true
+}
+
+// links returns the links found on the given page which point under the base URL, with their targets replaced by
+// their paths so that they can be compared with diffLinks.
+func (side comparedSide) links(u CanonicalURL) []Edge {
+	var links []Edge
+	for _, e := range side.sitemap.Outbound(u) {
+		path, ok := side.path(e.To)
+		if ok {
+			links = append(links, Edge{From: e.From, To: CanonicalURL(path)})
+		}
+	}
+
+	return links
+}
+
+func sortedPaths(pages map[string]Node) []string {
+	var paths []string
+	for p := range pages {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+func pathsToLines(prefix string, paths []string) []string {
+	var lines []string
+	for _, p := range paths {
+		lines = append(lines, prefix+p)
+	}
+
+	return lines
+}
+
+func pathLinksToLines(prefix string, links map[string][]string) []string {
+	var paths []string
+	for p := range links {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, p := range paths {
+		for _, l := range links[p] {
+			lines = append(lines, fmt.Sprintf("%s%s -> %s", prefix, p, l))
+		}
+	}
+
+	return lines
+}
+
+func statusDifferencesToLines(differences []PathDifference) []string {
+	var lines []string
+	for _, d := range differences {
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s", d.Path, d.Left, d.Right))
+	}
+
+	return lines
+}
+
+func contentDifferencesToLines(differences []PathDifference) []string {
+	var lines []string
+	for _, d := range differences {
+		lines = append(lines, d.Path)
+	}
+
+	return lines
+}
+
+func collisionsToLines(collisions map[string][]string) []string {
+	var paths []string
+	for p := range collisions {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, p := range paths {
+		lines = append(lines, fmt.Sprintf("%s: %s", p, strings.Join(collisions[p], ", ")))
+	}
+
+	return lines
+}
@@ -0,0 +1,207 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func getTestComparisonSnapshots() (Snapshot, Snapshot) {
+	staging := Snapshot{Start: "https://staging.test.com/", Sitemap: NewSitemap()}
+	production := Snapshot{Start: "https://test.com", Sitemap: NewSitemap()}
+
+	for _, p := range []Page{
+		{Addr: "https://staging.test.com/en", Links: Links{"https://staging.test.com/en/foo", "https://staging.test.com/en/new", "https://staging.test.com/fr"}, Status: 200, Hash: "a"},
+		{Addr: "https://staging.test.com/en/foo", Links: Links{"https://staging.test.com/en"}, Status: 200, Hash: "b", Depth: 1},
+		{Addr: "https://staging.test.com/en/new", Status: 200, Hash: "c", Depth: 1},
+		{Addr: "https://staging.test.com/fr", Status: 200, Hash: "d", Depth: 1},
+	} {
+		staging.Sitemap.AddPage(p)
+	}
+	staging.Sitemap.AddNode(Node{URL: "https://staging.test.com/en/bar", Error: "timeout", Depth: 1})
+
+	for _, p := range []Page{
+		{Addr: "https://test.com", Links: Links{"https://test.com/foo", "https://test.com/bar", "https://test.com/old"}, Status: 200, Hash: "a"},
+		{Addr: "https://test.com/foo", Links: Links{"https://test.com"}, Status: 200, Hash: "changed", Depth: 1},
+		{Addr: "https://test.com/bar", Status: 200, Depth: 1},
+		{Addr: "https://test.com/old", Status: 404, Depth: 1},
+	} {
+		production.Sitemap.AddPage(p)
+	}
+
+	return staging, production
+}
+
+func TestCompare(t *testing.T) {
+	staging, production := getTestComparisonSnapshots()
+
+	c, err := Compare(staging, production, []PathMapping{{From: "/en/", To: "/"}})
+	if err != nil {
+		t.Errorf("Compare(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if c.Empty() {
+		t.Error("Empty(): expected the comparison not to be empty")
+	}
+
+	if c.Left != "https://staging.test.com" || c.Right != "https://test.com" {
+		t.Errorf("Compare(): expected the base URLs https://staging.test.com and https://test.com, got %s and %s", c.Left, c.Right)
+	}
+
+	var tests = []struct {
+		name     string
+		actual   interface{}
+		expected string
+	}{
+		{"MissingLeft", c.MissingLeft, "[/old]"},
+		{"MissingRight", c.MissingRight, "[/fr /new]"},
+		{"LinksOnlyLeft", c.LinksOnlyLeft, "map[/:[/fr /new]]"},
+		{"LinksOnlyRight", c.LinksOnlyRight, "map[/:[/bar /old]]"},
+		{"StatusDifferences", c.StatusDifferences, "[{/bar error: timeout 200}]"},
+		{"ContentDifferences", c.ContentDifferences, "[{/foo b changed}]"},
+	}
+
+	for _, test := range tests {
+		if fmt.Sprint(test.actual) != test.expected {
+			t.Errorf("Compare(): expected %s %s, got %v", test.name, test.expected, test.actual)
+		}
+	}
+}
+
+func TestCompareIdenticalCrawls(t *testing.T) {
+	_, production := getTestComparisonSnapshots()
+
+	c, err := Compare(production, production, nil)
+	if err != nil {
+		t.Errorf("Compare(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if !c.Empty() {
+		t.Errorf("Empty(): expected no differences between identical crawls, got %v", c)
+	}
+}
+
+func TestCompareReportsPathCollisions(t *testing.T) {
+	_, production := getTestComparisonSnapshots()
+
+	// Both /foo and /en/foo are mapped to /foo, and only the first of them is compared.
+	staging := Snapshot{Start: "https://staging.test.com", Sitemap: NewSitemap()}
+	for _, p := range []Page{
+		{Addr: "https://staging.test.com", Links: Links{"https://staging.test.com/en/foo", "https://staging.test.com/foo"}, Status: 200, Hash: "a"},
+		{Addr: "https://staging.test.com/en/foo", Links: Links{"https://staging.test.com"}, Status: 200, Hash: "changed", Depth: 1},
+		{Addr: "https://staging.test.com/foo", Status: 500, Hash: "other", Depth: 1},
+	} {
+		staging.Sitemap.AddPage(p)
+	}
+
+	c, err := Compare(staging, production, []PathMapping{{From: "/en", To: "/"}})
+	if err != nil {
+		t.Errorf("Compare(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expected := "map[/foo:[https://staging.test.com/en/foo https://staging.test.com/foo]]"
+	if fmt.Sprint(c.Collisions) != expected {
+		t.Errorf("Compare(): expected Collisions %s, got %v", expected, c.Collisions)
+	}
+
+	if len(c.StatusDifferences) != 0 || len(c.ContentDifferences) != 0 {
+		t.Errorf("Compare(): expected the first page mapped to /foo to be compared, got %v and %v", c.StatusDifferences, c.ContentDifferences)
+	}
+
+	text, err := ComparisonText(c)
+	if err != nil {
+		t.Errorf("ComparisonText(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	line := "path collisions on the left (1):\n\n/foo: https://staging.test.com/en/foo, https://staging.test.com/foo\n"
+	if !strings.Contains(text, line) {
+		t.Errorf("ComparisonText(): expected the output to contain %q, got:\n%s", line, text)
+	}
+}
+
+func TestCompareInvalidBaseURL(t *testing.T) {
+	_, production := getTestComparisonSnapshots()
+
+	_, err := Compare(Snapshot{Start: "/relative", Sitemap: NewSitemap()}, production, nil)
+	if err == nil {
+		t.Error("Compare(): expected an error for a relative base URL")
+	}
+}
+
+func TestComparedSidePath(t *testing.T) {
+	side := comparedSide{base: "https://test.com/app", mappings: []PathMapping{{From: "/v1", To: "/v2"}, {From: "", To: "/old"}}}
+
+	var tests = []struct {
+		url      CanonicalURL
+		expected string
+		ok       bool
+	}{
+		{"https://test.com/app", "/old", true},
+		{"https://test.com/app/v1", "/v2", true},
+		{"https://test.com/app/v1/page", "/v2/page", true},
+		{"https://test.com/app/v10", "/old/v10", true},
+		{"https://test.com/application", "", false},
+		{"https://other.com/app", "", false},
+	}
+
+	for _, test := range tests {
+		actual, ok := side.path(test.url)
+		if actual != test.expected || ok != test.ok {
+			t.Errorf("path(%s): expected %q (%v), got %q (%v)", test.url, test.expected, test.ok, actual, ok)
+		}
+	}
+}
+
+func TestComparisonText(t *testing.T) {
+	staging, production := getTestComparisonSnapshots()
+
+	c, _ := Compare(staging, production, []PathMapping{{From: "/en", To: "/"}})
+
+	text, err := ComparisonText(c)
+	if err != nil {
+		t.Errorf("ComparisonText(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	for _, line := range []string{
+		"left:  https://staging.test.com\n",
+		"missing on the left (1):\n\n+ /old\n",
+		"missing on the right (2):\n\n- /fr\n- /new\n",
+		"links only on the left (2):\n\n- / -> /fr\n- / -> /new\n",
+		"links only on the right (2):\n\n+ / -> /bar\n+ / -> /old\n",
+		"status differences (1):\n\n/bar: error: timeout -> 200\n",
+		"content differences (1):\n\n/foo\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("ComparisonText(): expected the output to contain %q, got:\n%s", line, text)
+		}
+	}
+}
+
+func TestComparisonJSON(t *testing.T) {
+	_, production := getTestComparisonSnapshots()
+
+	c, _ := Compare(production, production, nil)
+
+	js, err := ComparisonJSON(c)
+	if err != nil {
+		t.Errorf("ComparisonJSON(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	var decoded Comparison
+	err = json.Unmarshal([]byte(js), &decoded)
+	if err != nil {
+		t.Errorf("ComparisonJSON(): expected valid JSON, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if !strings.Contains(js, `"missingLeft": []`) || decoded.Right != "https://test.com" {
+		t.Errorf("ComparisonJSON(): expected empty lists and the base URLs, got:\n%s", js)
+	}
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"net/http"
+)
+
+// validators returns the details of the given page from the previous crawl, and whether it was served with validators
+// which can be sent in a conditional request.
+func (p *Parser) validators(u CanonicalURL) (Node, bool) {
+	if p.previous == nil {
+		return Node{}, false
+	}
+
+	n, ok := p.previous.Node(u)
+	if !ok || !n.Crawled || n.RedirectsTo != "" || (n.ETag == "" && n.LastModified == "") {
+		return Node{}, false
+	}
+
+	return n, true
+}
+
+// setConditionalHeaders asks for the page to be sent only if it was modified since it was served with the given validators.
+func setConditionalHeaders(req *http.Request, previous Node) {
+	if previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+
+	if previous.LastModified != "" {
+		req.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+}
+
+// notModified returns the page which wasn't modified since the previous crawl, with its details and links taken from it.
+// Validators sent along with the 304 response replace the previous ones.
+func (p *Parser) notModified(previous Node, resp *http.Response) Page {
+	page := Page{Addr: previous.URL, Status: previous.Status, Title: previous.Title, ContentType: previous.ContentType,
+		Size: previous.Size, Hash: previous.Hash, ETag: previous.ETag, LastModified: previous.LastModified, NotModified: true}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		page.ETag = etag
+	}
+
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		page.LastModified = lastModified
+	}
+
+	anchors := make(map[string]Anchor)
+	for _, e := range p.previous.Outbound(previous.URL) {
+		link := string(e.To)
+
+		n, _ := p.previous.Node(e.To)
+		if n.External {
+			page.External = append(page.External, link)
+		} else {
+			page.Links = append(page.Links, link)
+		}
+
+		anchors[link] = Anchor{Rel: e.Rel, Text: e.Text}
+	}
+
+	page.Anchors = anchors
+
+	return page
+}
@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// versionedSite is a test site serving its pages with an ETag (and the home page with a Last-Modified date only),
+// answering conditional requests with 304 Not Modified unless the page was edited since.
+type versionedSite struct {
+	mutex       sync.Mutex
+	pages       map[string]string
+	versions    map[string]int
+	conditional int
+}
+
+func (s *versionedSite) edit(path string, body string) {
+	s.mutex.Lock()
+	s.pages[path] = body
+	s.versions[path]++
+	s.mutex.Unlock()
+}
+
+func (s *versionedSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	body, ok := s.pages[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		s.conditional++
+	}
+
+	if r.URL.Path == "/" {
+		lastModified := fmt.Sprintf("Mon, 0%d Jan 2018 00:00:00 GMT", s.versions[r.URL.Path]+1)
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else {
+		etag := fmt.Sprintf(`"%s-%d"`, r.URL.Path, s.versions[r.URL.Path])
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	fmt.Fprint(w, body)
+}
+
+func getVersionedSite() (*versionedSite, *httptest.Server) {
+	site := &versionedSite{
+		pages: map[string]string{
+			"/":    `<a href="/foo" rel="nofollow">Foo</a><a href="/bar">Bar</a><a href="https://external.com">Out</a>`,
+			"/foo": `<title>Foo</title><p>foo</p>`,
+			"/bar": `<p>bar</p>`,
+		},
+		versions: make(map[string]int),
+	}
+
+	return site, httptest.NewServer(site)
+}
+
+func TestCrawlSendsConditionalRequests(t *testing.T) {
+	site, ts := getVersionedSite()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+
+	c := NewCrawler(u, 0)
+	previous := c.Crawl(context.TODO())
+
+	if site.conditional != 0 {
+		t.Errorf("Crawl(): expected no conditional requests without a previous crawl, got %d", site.conditional)
+	}
+
+	site.edit("/bar", `<p>bar, edited</p>`)
+
+	c = NewCrawler(u, 0)
+	c.SetPrevious(previous)
+	current := c.Crawl(context.TODO())
+
+	if site.conditional != 3 {
+		t.Errorf("Crawl(): expected 3 conditional requests, got %d", site.conditional)
+	}
+
+	if stats := c.Stats(); stats.Pages != 3 || stats.NotModified != 2 {
+		t.Errorf("Stats(): expected 3 pages, 2 of them not modified, got %d and %d", stats.Pages, stats.NotModified)
+	}
+
+	// The pages which weren't modified keep their details and links, so nothing changed but the edited page.
+	for _, n := range previous.Nodes() {
+		actual, _ := current.Node(n.URL)
+		if n.URL != CanonicalURL(ts.URL+"/bar") && fmt.Sprint(actual) != fmt.Sprint(n) {
+			t.Errorf("Crawl(): expected %s to be the same as in the previous crawl %v, got %v", n.URL, n, actual)
+		}
+	}
+
+	if fmt.Sprint(current.Outbound(CanonicalURL(ts.URL))) != fmt.Sprint(previous.Outbound(CanonicalURL(ts.URL))) {
+		t.Errorf("Crawl(): expected the links of the home page to be reused, got %v", current.Outbound(CanonicalURL(ts.URL)))
+	}
+
+	d := Diff(Snapshot{Sitemap: previous}, Snapshot{Sitemap: current})
+	if fmt.Sprint(d.ChangedPages) != fmt.Sprintf("[%s/bar]", ts.URL) || len(d.AddedLinks)+len(d.RemovedLinks) != 0 {
+		t.Errorf("Diff(): expected only %s/bar to have changed, got %v", ts.URL, d)
+	}
+}
+
+func TestParseIgnoresPreviousPagesWithoutValidators(t *testing.T) {
+	var conditional bool
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != ""
+		fmt.Fprint(w, `<a href="/foo">foo</a>`)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+
+	previous := NewSitemap()
+	previous.AddPage(Page{Addr: CanonicalURL(ts.URL), Status: http.StatusOK})
+
+	p := NewParser(u.Scheme, u.Host)
+	p.SetPrevious(previous)
+
+	page, err := p.parse(context.TODO(), ts.URL)
+	if err != nil {
+		t.Errorf("parse(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if conditional || page.NotModified || len(page.Links) != 1 {
+		t.Errorf("parse(): expected the page to be fetched unconditionally, got %v", page)
+	}
+}
@@ -5,12 +5,9 @@ import (
 	"log"
 	"net/url"
 	"sync"
+	"time"
 )
 
-// Sitemap is the data structure holding current sitemap information.
-// It's a map of a page URL to the links found on that page.
-type Sitemap map[CanonicalURL]Links
-
 // CanonicalURL represents the normalised page URL (a full URL with no query params or fragments).
 type CanonicalURL string
 
@@ -22,9 +19,14 @@ type Crawler struct {
 	startURL     string
 	maxDepth     int
 	parser       Parser
-	sitemap      Sitemap
+	sitemap      *Sitemap
+	visited      map[CanonicalURL]bool
 	sMutex       sync.Mutex
 	keepCrawling bool
+	store        Store
+	runID        string
+	stats        Stats
+	metrics      *Metrics
 }
 
 // NewCrawler returns an instance of the Crawler with all its required properties initialised.
@@ -38,29 +40,77 @@ func NewCrawler(start *url.URL, depth int) Crawler {
 		startURL:     start.String(),
 		maxDepth:     depth,
 		parser:       p,
-		sitemap:      make(Sitemap),
+		sitemap:      NewSitemap(),
+		visited:      make(map[CanonicalURL]bool),
 		sMutex:       sync.Mutex{},
 		keepCrawling: true,
 	}
 }
 
+// SetStore makes the Crawler save every page to the given store as soon as it's crawled, as part of the given run.
+// Errors saving pages are logged, and don't stop the crawl.
+func (c *Crawler) SetStore(s Store, runID string) {
+	c.store = s
+	c.runID = runID
+}
+
+// SetFetchOptions changes how the Crawler fetches pages, e.g. the timeout for fetching a single page.
+func (c *Crawler) SetFetchOptions(o FetchOptions) {
+	c.parser.SetFetchOptions(o)
+}
+
+// Login logs in as described by the fetch options, if they include a login. The Crawler logs in by itself before
+// fetching the first page, so calling Login is only needed to find out about login errors before crawling.
+// Cancelling the given context interrupts logging in.
+func (c *Crawler) Login(ctx context.Context) error {
+	return c.parser.login(ctx)
+}
+
+// SetPrevious makes the Crawler send conditional requests (If-None-Match and If-Modified-Since) for the pages found in
+// the given sitemap, e.g. a saved previous crawl of the site. Pages which weren't modified since then aren't downloaded
+// again: their details and links are taken from the previous crawl, and they're marked as NotModified.
+func (c *Crawler) SetPrevious(s *Sitemap) {
+	c.parser.SetPrevious(s)
+}
+
+// SetMetrics makes the Crawler record its fetches, errors and frontier size in the given metrics.
+func (c *Crawler) SetMetrics(m *Metrics) {
+	c.metrics = m
+	c.parser.SetMetrics(m)
+}
+
 // Crawl will start crawling the URL given to the Crawler as the starting URL.
-// Once the maximum depth is reached or no new pages are found, a Sitemap struct will be returned with the results.
+// Once the maximum depth is reached or no new pages are found, a Sitemap will be returned with the results.
 // Crawl accepts a cancellable context and stops crawling when the context is cancelled, returning the current results.
-func (c *Crawler) Crawl(ctx context.Context) Sitemap {
-	var sitemap Sitemap
+func (c *Crawler) Crawl(ctx context.Context) *Sitemap {
+	var sitemap *Sitemap
 
-	out := make(chan Sitemap, 1)
+	c.sMutex.Lock()
+	c.stats.Started = time.Now()
+	c.sMutex.Unlock()
+
+	defer func() {
+		c.sMutex.Lock()
+		c.stats.Finished = time.Now()
+		c.sMutex.Unlock()
+
+		// Connections are only reused within a crawl.
+		c.parser.close()
+	}()
+
+	out := make(chan *Sitemap, 1)
 
 	go func() {
 		defer close(out)
-		c.parsePage(c.startURL, 0)
+		c.parsePage(ctx, c.startURL, 0)
 		out <- c.sitemap
 	}()
 
 	select {
 	case <-ctx.Done():
+		c.sMutex.Lock()
 		c.keepCrawling = false
+		c.sMutex.Unlock()
 		sitemap = <-out
 	case sitemap = <-out:
 	}
@@ -68,20 +118,35 @@ func (c *Crawler) Crawl(ctx context.Context) Sitemap {
 	return sitemap
 }
 
-func (c *Crawler) parsePage(l string, lvl int) {
+func (c *Crawler) parsePage(ctx context.Context, l string, lvl int) {
 
-	if c.keepCrawling && (c.maxDepth == 0 || lvl < c.maxDepth) && !c.known(CanonicalURL(l)) {
-		page, err := c.parser.parse(l)
+	if c.crawling() && (c.maxDepth == 0 || lvl < c.maxDepth) && !c.known(CanonicalURL(l)) {
+		page, err := c.parser.parse(ctx, l)
+		if err != nil && ctx.Err() != nil {
+			// The crawl was cancelled while fetching the page, so it's left out like the pages which weren't fetched yet.
+			return
+		}
 		if err != nil {
 			log.Printf("parsing %s returned an error: %s", l, err.Error())
+			c.addFailure(Page{Addr: CanonicalURL(l), Depth: lvl, Error: err.Error(), Attempts: page.Attempts})
 			return
 		}
 
+		page.Depth = lvl
 		c.add(page)
 
+		follow := c.maxDepth == 0 || lvl+1 < c.maxDepth
+		if follow {
+			c.queue(len(page.Links))
+		}
+
 		for _, link := range page.Links {
+			if follow {
+				c.queue(-1)
+			}
+
 			if !c.known(CanonicalURL(link)) {
-				c.parsePage(link, lvl+1)
+				c.parsePage(ctx, link, lvl+1)
 			}
 		}
 	}
@@ -91,13 +156,65 @@ func (c *Crawler) parsePage(l string, lvl int) {
 
 func (c *Crawler) add(p Page) {
 	c.sMutex.Lock()
-	c.sitemap[p.Addr] = p.Links
+	c.sitemap.AddPage(p)
+	c.visited[p.Addr] = true
+	if p.RedirectedFrom != "" {
+		c.visited[CanonicalURL(p.RedirectedFrom)] = true
+	}
+	c.stats.Pages++
+	if p.NotModified {
+		c.stats.NotModified++
+	}
+	c.sMutex.Unlock()
+
+	c.save(p)
+}
+
+// addFailure records a page which couldn't be fetched.
+// It's added to the sitemap as a page which hasn't been crawled, along with the error.
+func (c *Crawler) addFailure(p Page) {
+	c.sMutex.Lock()
+	c.sitemap.AddNode(Node{URL: p.Addr, Depth: p.Depth, Error: p.Error, Attempts: p.Attempts})
+	c.visited[p.Addr] = true
+	c.stats.Errors++
+	c.sMutex.Unlock()
+
+	c.save(p)
+}
+
+func (c *Crawler) save(p Page) {
+	if c.store == nil {
+		return
+	}
+
+	err := c.store.SavePage(c.runID, p)
+	if err != nil {
+		log.Printf("saving %s to the store returned an error: %s", p.Addr, err.Error())
+	}
+}
+
+// queue records links found which are waiting to be visited (or visited, if n is negative).
+func (c *Crawler) queue(n int) {
+	c.sMutex.Lock()
+	c.stats.Queued += n
 	c.sMutex.Unlock()
+
+	c.metrics.queued(n)
+}
+
+// crawling returns false once the crawl has been cancelled.
+func (c *Crawler) crawling() bool {
+	c.sMutex.Lock()
+	defer c.sMutex.Unlock()
+
+	return c.keepCrawling
 }
 
+// known returns whether the given page has already been visited: crawled, failed to be fetched, or redirected to
+// another page, so that it isn't fetched again.
 func (c *Crawler) known(u CanonicalURL) bool {
 	c.sMutex.Lock()
-	_, ok := c.sitemap[u]
+	ok := c.visited[u]
 	c.sMutex.Unlock()
 
 	return ok
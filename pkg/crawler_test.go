@@ -7,7 +7,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestCrawl(t *testing.T) {
@@ -30,17 +33,17 @@ func TestCrawl(t *testing.T) {
 
 	actual := c.Crawl(context.TODO())
 
-	if len(actual) != 1 {
-		t.Errorf("Crawl(): expected 1 page in sitemap, got %d", len(actual))
+	if len(actual.Pages()) != 1 {
+		t.Errorf("Crawl(): expected 1 page in sitemap, got %d", len(actual.Pages()))
 		t.FailNow()
 	}
 
-	for key, links := range actual {
-		if key != CanonicalURL(ts.URL) {
-			t.Errorf("Crawl(): expected page in sitemap to be %s, got %s", CanonicalURL(ts.URL), key)
+	for _, page := range actual.Pages() {
+		if page.URL != CanonicalURL(ts.URL) {
+			t.Errorf("Crawl(): expected page in sitemap to be %s, got %s", CanonicalURL(ts.URL), page.URL)
 		}
 
-		for _, ll := range links {
+		for _, ll := range internalLinks(actual, page.URL) {
 			if ll != ts.URL+"/foo/bar" {
 				t.Errorf("Crawl(): expected page link in sitemap to be %s, got %s", ts.URL+"/foo/bar", ll)
 			}
@@ -71,12 +74,92 @@ func TestCrawlRespectsContextCancellation(t *testing.T) {
 		t.FailNow()
 	}
 
-	if len(actual) != 0 {
-		t.Errorf("Crawl(): expected the sitemap to be empty, got %v", actual)
+	if len(actual.Nodes()) != 0 {
+		t.Errorf("Crawl(): expected the sitemap to be empty, got %v", actual.Nodes())
 		t.FailNow()
 	}
 }
 
+func TestCrawlStopsRetryingWhenCancelled(t *testing.T) {
+	var requests int64
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Crawl(cancelled ctx): failed to parse test server addr %s as URL", ts.URL)
+	}
+
+	c := NewCrawler(tsURL, 1)
+	c.SetFetchOptions(FetchOptions{Retries: 3})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	actual := c.Crawl(ctx)
+
+	// The crawl stops while waiting to retry the page, instead of waiting for the Retry-After delay.
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Crawl(cancelled ctx): expected the crawl to stop while backing off, took %s", elapsed)
+	}
+
+	if atomic.LoadInt64(&requests) != 1 {
+		t.Errorf("Crawl(cancelled ctx): expected the page not to be retried, got %d request(s)", atomic.LoadInt64(&requests))
+	}
+
+	if len(actual.Nodes()) != 0 {
+		t.Errorf("Crawl(cancelled ctx): expected the interrupted page to be left out, got %v", actual.Nodes())
+	}
+}
+
+func TestCrawlVisitsPagesOnce(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[string]int)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/old">old</a><a href="/broken">broken</a><a href="/foo">foo</a>`)
+		case "/foo":
+			fmt.Fprint(w, `<a href="/old">old</a><a href="/broken">broken</a>`)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			fmt.Fprint(w, `<p>new</p>`)
+		default:
+			// Redirects outside the starting domain make the fetch fail.
+			http.Redirect(w, r, "https://external.com", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+
+	c := NewCrawler(tsURL, 0)
+	c.Crawl(context.TODO())
+
+	// Links to pages which redirected or failed are found again after they were visited, but they aren't fetched again.
+	for _, path := range []string{"/old", "/broken"} {
+		if requests[path] != 1 {
+			t.Errorf("Crawl(): expected %s to be requested once, got %d", path, requests[path])
+		}
+	}
+
+	if stats := c.Stats(); stats.Pages != 3 || stats.Errors != 1 {
+		t.Errorf("Stats(): expected 3 pages and 1 error, got %v", stats)
+	}
+}
+
 func TestParsePage(t *testing.T) {
 	rawhtml, err := ioutil.ReadFile("../fixtures/simple.html")
 	if err != nil {
@@ -95,13 +178,13 @@ func TestParsePage(t *testing.T) {
 
 	c := NewCrawler(tsURL, 1)
 
-	c.parsePage(ts.URL, 0)
+	c.parsePage(context.TODO(), ts.URL, 0)
 
 	expected := Links{
 		"https://local.com/foo/bar",
 	}
 
-	actual := c.sitemap[CanonicalURL(ts.URL)]
+	actual := internalLinks(c.sitemap, CanonicalURL(ts.URL))
 
 	if len(actual) != len(expected) {
 		t.Errorf("parsePage(): expected %d links in sitemap, got %d", len(expected), len(actual))
@@ -129,21 +212,22 @@ func TestParsePageRecursive(t *testing.T) {
 
 	c := NewCrawler(tsURL, 2)
 
-	c.parsePage(ts.URL, 0)
+	c.parsePage(context.TODO(), ts.URL, 0)
 
-	if len(c.sitemap) != 2 {
-		t.Errorf("parsePage(): expected 2 links in sitemap, got %d", len(c.sitemap))
-		t.Errorf("actual: %v", c.sitemap)
+	if len(c.sitemap.Pages()) != 2 {
+		t.Errorf("parsePage(): expected 2 pages in sitemap, got %d", len(c.sitemap.Pages()))
+		t.Errorf("actual: %v", c.sitemap.Pages())
 	}
 
 	expected1 := Page{Addr: CanonicalURL(ts.URL), Links: Links{ts.URL + "/foo"}}
 	expected2 := Page{Addr: CanonicalURL(ts.URL + "/foo"), Links: Links{ts.URL + "/foo/bar"}}
 
-	actual1, found := c.sitemap[expected1.Addr]
-	if !found {
-		t.Errorf("parsePage(): expected sitemap %v to contain page %s", c.sitemap, expected1.Addr)
+	if !c.sitemap.Crawled(expected1.Addr) {
+		t.Errorf("parsePage(): expected sitemap %v to contain page %s", c.sitemap.Pages(), expected1.Addr)
 	}
 
+	actual1 := internalLinks(c.sitemap, expected1.Addr)
+
 	if len(actual1) != 1 {
 		t.Errorf("parsePage(): expected page %s to have one link, got %v", expected1.Addr, actual1)
 	}
@@ -154,11 +238,12 @@ func TestParsePageRecursive(t *testing.T) {
 		}
 	}
 
-	actual2, found := c.sitemap[expected2.Addr]
-	if !found {
-		t.Errorf("parsePage(): expected sitemap %v to contain page %s", c.sitemap, expected2.Addr)
+	if !c.sitemap.Crawled(expected2.Addr) {
+		t.Errorf("parsePage(): expected sitemap %v to contain page %s", c.sitemap.Pages(), expected2.Addr)
 	}
 
+	actual2 := internalLinks(c.sitemap, expected2.Addr)
+
 	if len(actual2) != 1 {
 		t.Errorf("parsePage(): expected page %s to have one link, got %v", expected2.Addr, actual2)
 	}
@@ -170,12 +255,116 @@ func TestParsePageRecursive(t *testing.T) {
 	}
 }
 
+func TestParsePageRecordsPageDepth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/foo" {
+			fmt.Fprintln(w, "<title>Foo</title><p>This is foo.</p>")
+		} else {
+			fmt.Fprintln(w, "<title>Home</title><p>Go to <a href=\"/foo\">foo</a>.</p>")
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("parsePage(): failed to parse test server addr %s as URL", ts.URL)
+	}
+
+	c := NewCrawler(tsURL, 2)
+
+	c.parsePage(context.TODO(), ts.URL, 0)
+
+	pages := c.sitemap.Pages()
+
+	if len(pages) != 2 {
+		t.Errorf("parsePage(): expected 2 pages recorded, got %d", len(pages))
+		t.FailNow()
+	}
+
+	expected := map[CanonicalURL]Page{
+		CanonicalURL(ts.URL):          {Title: "Home", Depth: 0},
+		CanonicalURL(ts.URL + "/foo"): {Title: "Foo", Depth: 1},
+	}
+
+	for addr, e := range expected {
+		actual, _ := c.sitemap.Node(addr)
+		if actual.Title != e.Title || actual.Depth != e.Depth || actual.Status != http.StatusOK {
+			t.Errorf("parsePage(): expected page %s to have title %q, depth %d and status 200, got %q, %d and %d",
+				addr, e.Title, e.Depth, actual.Title, actual.Depth, actual.Status)
+		}
+	}
+}
+
+func TestParsePageRecordsFailures(t *testing.T) {
+	c := NewCrawler(&url.URL{}, 2)
+
+	c.parsePage(context.TODO(), "", 1)
+
+	if len(c.sitemap.Pages()) > 0 {
+		t.Errorf("parsePage(): no pages were expected to be crawled, got %v", c.sitemap.Pages())
+	}
+
+	failed, ok := c.sitemap.Node(CanonicalURL(""))
+	if !ok {
+		t.Errorf("parsePage(): expected the failed page to be recorded, got %v", c.sitemap.Nodes())
+		t.FailNow()
+	}
+
+	if failed.Error == "" || failed.Depth != 1 {
+		t.Errorf("parsePage(): expected the failed page to have an error and depth 1, got %v", failed)
+	}
+}
+
+type memStore struct {
+	Store
+	pages []Page
+}
+
+func (s *memStore) SavePage(runID string, p Page) error {
+	s.pages = append(s.pages, p)
+	return nil
+}
+
+func TestParsePageSavesPagesToStore(t *testing.T) {
+	rawhtml, err := ioutil.ReadFile("../fixtures/simple.html")
+	if err != nil {
+		t.Fatalf("failed to parse the %s fixture file: %s", "simple.html", err.Error())
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, string(rawhtml))
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("parsePage(): failed to parse test server addr %s as URL", ts.URL)
+	}
+
+	s := &memStore{}
+
+	c := NewCrawler(tsURL, 1)
+	c.SetStore(s, "run")
+
+	c.parsePage(context.TODO(), ts.URL, 0)
+	c.parsePage(context.TODO(), "", 0)
+
+	if len(s.pages) != 2 {
+		t.Errorf("parsePage(): expected 2 pages saved to the store, got %v", s.pages)
+		t.FailNow()
+	}
+
+	if s.pages[0].Addr != CanonicalURL(ts.URL) || s.pages[1].Error == "" {
+		t.Errorf("parsePage(): expected the crawled page and the failed page to be saved, got %v", s.pages)
+	}
+}
+
 func TestParsePageRespectsMaxDepth(t *testing.T) {
 	c := NewCrawler(&url.URL{}, 2)
-	c.parsePage("", 3)
+	c.parsePage(context.TODO(), "", 3)
 
-	if len(c.sitemap) > 0 {
-		t.Errorf("sitemap was expected to be empty, got %v", c.sitemap)
+	if len(c.sitemap.Nodes()) > 0 {
+		t.Errorf("sitemap was expected to be empty, got %v", c.sitemap.Nodes())
 	}
 }
 
@@ -197,13 +386,13 @@ func TestParsePageIgnoresMaxDepthIfSetToUnlimited(t *testing.T) {
 
 	c := NewCrawler(tsURL, 0)
 
-	c.parsePage(ts.URL, -1)
+	c.parsePage(context.TODO(), ts.URL, -1)
 
 	expected := Links{
 		"https://local.com/foo/bar",
 	}
 
-	actual := c.sitemap[CanonicalURL(ts.URL)]
+	actual := internalLinks(c.sitemap, CanonicalURL(ts.URL))
 
 	if len(actual) != len(expected) {
 		t.Errorf("parsePage(): expected %d links in sitemap, got %d", len(expected), len(actual))
@@ -215,10 +404,10 @@ func TestParsePageIgnoresMaxDepthIfSetToUnlimited(t *testing.T) {
 func TestParsePageRespectsCancellationFlag(t *testing.T) {
 	c := NewCrawler(&url.URL{}, 0)
 	c.keepCrawling = false
-	c.parsePage("", 1)
+	c.parsePage(context.TODO(), "", 1)
 
-	if len(c.sitemap) > 0 {
-		t.Errorf("sitemap was expected to be empty, got %v", c.sitemap)
+	if len(c.sitemap.Nodes()) > 0 {
+		t.Errorf("sitemap was expected to be empty, got %v", c.sitemap.Nodes())
 	}
 }
 
@@ -228,25 +417,27 @@ func TestAdd(t *testing.T) {
 
 	c := NewCrawler(&url.URL{}, 0)
 
-	if _, ok := c.sitemap[addr]; ok {
-		t.Errorf("add(): sitemap %v was not expected to contain %s", c.sitemap, addr)
+	if c.sitemap.Crawled(addr) {
+		t.Errorf("add(): sitemap %v was not expected to contain %s", c.sitemap.Pages(), addr)
 	}
 
 	c.add(p)
 
-	if _, ok := c.sitemap[addr]; !ok {
-		t.Errorf("add(): expected sitemap %v to contain %s", c.sitemap, addr)
+	if !c.sitemap.Crawled(addr) {
+		t.Errorf("add(): expected sitemap %v to contain %s", c.sitemap.Pages(), addr)
 	}
 
-	if len(c.sitemap[addr]) != len(p.Links) {
-		t.Errorf("add(): expected %d links saved, got %d", len(c.sitemap[addr]), len(p.Links))
+	actual := internalLinks(c.sitemap, addr)
+
+	if len(actual) != len(p.Links) {
+		t.Errorf("add(): expected %d links saved, got %d", len(p.Links), len(actual))
 		t.Errorf("expected: %v", p.Links)
-		t.Errorf("actual: %v", c.sitemap[addr])
+		t.Errorf("actual: %v", actual)
 	}
 
 	for _, ll := range p.Links {
 		found := false
-		for _, kk := range c.sitemap[addr] {
+		for _, kk := range actual {
 			if kk == ll {
 				found = true
 				break
@@ -254,7 +445,7 @@ func TestAdd(t *testing.T) {
 		}
 
 		if !found {
-			t.Errorf("add(): expected sitemap %v to contain %s", c.sitemap, ll)
+			t.Errorf("add(): expected links %v to contain %s", actual, ll)
 		}
 	}
 }
@@ -265,12 +456,37 @@ func TestKnown(t *testing.T) {
 	c := NewCrawler(&url.URL{}, 0)
 
 	if c.known(addr) {
-		t.Errorf("known(): sitemap %v was not expected to contain %s", c.sitemap, addr)
+		t.Errorf("known(): sitemap %v was not expected to contain %s", c.sitemap.Pages(), addr)
 	}
 
-	c.sitemap[addr] = Links{"https://bar.com", "http://baz.com"}
+	c.sitemap.AddEdge(Edge{From: CanonicalURL("https://bar.com"), To: addr})
+
+	if c.known(addr) {
+		t.Errorf("known(): expected %s not to be known until it's crawled", addr)
+	}
+
+	c.add(Page{Addr: addr, Links: Links{"https://bar.com", "http://baz.com"}, RedirectedFrom: "https://foo.com/old"})
 
 	if !c.known(addr) {
-		t.Errorf("known(): expected sitemap %v to contain %s", c.sitemap, addr)
+		t.Errorf("known(): expected sitemap %v to contain %s", c.sitemap.Pages(), addr)
+	}
+
+	// Pages which redirected or couldn't be fetched aren't fetched again either.
+	c.addFailure(Page{Addr: CanonicalURL("https://foo.com/broken"), Error: "broken"})
+
+	for _, u := range []CanonicalURL{"https://foo.com/old", "https://foo.com/broken"} {
+		if !c.known(u) {
+			t.Errorf("known(): expected %s to be known once it's been visited", u)
+		}
 	}
 }
+
+// internalLinks returns the targets of the links found on the given page, leaving out external links.
+func internalLinks(s *Sitemap, u CanonicalURL) []string {
+	var links []string
+	for _, e := range s.Internal().Outbound(u) {
+		links = append(links, string(e.To))
+	}
+
+	return links
+}
@@ -0,0 +1,356 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	// DefaultOutputFileDiffDot is the .dot file location to save the sitemap diff graph information to.
+	DefaultOutputFileDiffDot = "sitemap-diff.dot"
+
+	// DefaultOutputFileDiffSvg is the .svg file location to save the sitemap diff graph to.
+	DefaultOutputFileDiffSvg = "sitemap-diff.svg"
+)
+
+// SitemapDiff holds the differences between two crawls of the same site.
+// Links and contents are only compared for pages which were crawled both times.
+type SitemapDiff struct {
+	AddedPages     []CanonicalURL            `json:"addedPages"`
+	RemovedPages   []CanonicalURL            `json:"removedPages"`
+	ChangedPages   []CanonicalURL            `json:"changedPages"`
+	AddedLinks     map[CanonicalURL][]string `json:"addedLinks"`
+	RemovedLinks   map[CanonicalURL][]string `json:"removedLinks"`
+	StatusChanges  []StatusChange            `json:"statusChanges"`
+	NewBrokenLinks []LinkReport              `json:"newBrokenLinks"`
+}
+
+// StatusChange describes a page whose status changed between two crawls.
+// Old and New are status codes, or fetch errors if the page couldn't be fetched.
+type StatusChange struct {
+	Page CanonicalURL `json:"page"`
+	Old  string       `json:"old"`
+	New  string       `json:"new"`
+}
+
+// Diff compares two crawls, returning the pages and links which were added or removed, the pages whose contents
+// or status changed and the broken links which weren't broken before.
+// External pages and links are left out of the comparison.
+func Diff(before Snapshot, after Snapshot) SitemapDiff {
+	d := SitemapDiff{
+		AddedPages:     []CanonicalURL{},
+		RemovedPages:   []CanonicalURL{},
+		ChangedPages:   []CanonicalURL{},
+		AddedLinks:     make(map[CanonicalURL][]string),
+		RemovedLinks:   make(map[CanonicalURL][]string),
+		StatusChanges:  []StatusChange{},
+		NewBrokenLinks: []LinkReport{},
+	}
+
+	old, current := before.Sitemap.Internal(), after.Sitemap.Internal()
+
+	for _, page := range current.Pages() {
+		if !old.Crawled(page.URL) {
+			d.AddedPages = append(d.AddedPages, page.URL)
+			continue
+		}
+
+		oldPage, _ := old.Node(page.URL)
+		if changed(oldPage, page) {
+			d.ChangedPages = append(d.ChangedPages, page.URL)
+		}
+
+		added, removed := diffLinks(old.Outbound(page.URL), current.Outbound(page.URL))
+		if len(added) > 0 {
+			d.AddedLinks[page.URL] = added
+		}
+		if len(removed) > 0 {
+			d.RemovedLinks[page.URL] = removed
+		}
+	}
+
+	for _, page := range old.Pages() {
+		if !current.Crawled(page.URL) {
+			d.RemovedPages = append(d.RemovedPages, page.URL)
+		}
+	}
+
+	for _, n := range current.Nodes() {
+		oldNode, ok := old.Node(n.URL)
+		if !fetched(n) || !ok || !fetched(oldNode) {
+			continue
+		}
+
+		oldStatus, newStatus := statusText(oldNode), statusText(n)
+		if oldStatus != newStatus {
+			d.StatusChanges = append(d.StatusChanges, StatusChange{Page: n.URL, Old: oldStatus, New: newStatus})
+		}
+	}
+
+	wasBroken := make(map[[2]string]bool)
+	for _, l := range BrokenLinks(old) {
+		wasBroken[[2]string{l.Source, l.Target}] = true
+	}
+
+	for _, l := range BrokenLinks(current) {
+		if !wasBroken[[2]string{l.Source, l.Target}] {
+			d.NewBrokenLinks = append(d.NewBrokenLinks, l)
+		}
+	}
+
+	return d
+}
+
+// Empty returns true if the two crawls compared have no differences.
+func (d SitemapDiff) Empty() bool {
+	return len(d.AddedPages)+len(d.RemovedPages)+len(d.ChangedPages)+len(d.AddedLinks)+len(d.RemovedLinks)+len(d.StatusChanges)+len(d.NewBrokenLinks) == 0
+}
+
+// DiffText renders the given diff as text, listing every type of change.
+func DiffText(d SitemapDiff) (string, error) {
+	var buffer bytes.Buffer
+
+	sections := []struct {
+		title string
+		lines []string
+	}{
+		{"added pages", pagesToLines("+ ", d.AddedPages)},
+		{"removed pages", pagesToLines("- ", d.RemovedPages)},
+		{"changed pages", pagesToLines("~ ", d.ChangedPages)},
+		{"added links", linksToLines("+ ", d.AddedLinks)},
+		{"removed links", linksToLines("- ", d.RemovedLinks)},
+		{"status changes", statusChangesToLines(d.StatusChanges)},
+		{"new broken links", brokenLinksToLines(d.NewBrokenLinks)},
+	}
+
+	for _, section := range sections {
+		_, err := buffer.WriteString(fmt.Sprintf("\n%s (%d):\n\n", section.title, len(section.lines)))
+		if err != nil {
+			return "", fmt.Errorf("error generating the diff output: %s", err.Error())
+		}
+
+		for _, line := range section.lines {
+			_, err := buffer.WriteString(line + "\n")
+			if err != nil {
+				return "", fmt.Errorf("error writing the %s: %s", section.title, err.Error())
+			}
+		}
+	}
+
+	return buffer.String(), nil
+}
+
+// DiffJSON renders the given diff as indented JSON.
+func DiffJSON(d SitemapDiff) (string, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error generating the diff JSON: %s", err.Error())
+	}
+
+	return string(b), nil
+}
+
+// DiffGraph renders the differences between two crawls as a graph saved in an SVG file, using dot (see Graph).
+// Added pages and links are green, removed ones are red, and pages whose status changed are orange.
+func DiffGraph(before Snapshot, after Snapshot) error {
+	f, err := os.Create(DefaultOutputFileDiffDot)
+	if err != nil {
+		return fmt.Errorf("error creating the .dot output file writer: %s", err.Error())
+	}
+
+	defer f.Close()
+
+	err = writeDiffDot(f, before, after)
+	if err != nil {
+		return fmt.Errorf("error generating the dot file: %s", err.Error())
+	}
+
+	return runDot(DefaultOutputFileDiffDot, DefaultOutputFileDiffSvg)
+}
+
+func writeDiffDot(writer io.Writer, before Snapshot, after Snapshot) error {
+	d := Diff(before, after)
+
+	nodeColours := make(map[string]string)
+	for _, c := range d.StatusChanges {
+		nodeColours[string(c.Page)] = "orange"
+	}
+	for _, p := range d.AddedPages {
+		nodeColours[string(p)] = "green"
+	}
+	for _, p := range d.RemovedPages {
+		nodeColours[string(p)] = "red"
+	}
+
+	edgeStyles := make(map[[2]string]string)
+	for _, e := range before.Sitemap.Internal().Edges() {
+		edgeStyles[[2]string{string(e.From), string(e.To)}] = `color="red",style="dashed"`
+	}
+	for _, e := range after.Sitemap.Internal().Edges() {
+		edge := [2]string{string(e.From), string(e.To)}
+		if _, ok := edgeStyles[edge]; ok {
+			edgeStyles[edge] = `color="grey"`
+		} else {
+			edgeStyles[edge] = `color="green"`
+		}
+	}
+
+	var edges [][2]string
+	for edge := range edgeStyles {
+		edges = append(edges, edge)
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+
+	nodes := make(map[string]bool)
+	for _, edge := range edges {
+		nodes[edge[0]] = true
+		nodes[edge[1]] = true
+	}
+	for _, page := range before.Sitemap.Pages() {
+		nodes[string(page.URL)] = true
+	}
+	for _, page := range after.Sitemap.Pages() {
+		nodes[string(page.URL)] = true
+	}
+
+	var sortedNodes []string
+	for node := range nodes {
+		sortedNodes = append(sortedNodes, node)
+	}
+	sort.Strings(sortedNodes)
+
+	w := bufio.NewWriter(writer)
+
+	_, err := w.WriteString("digraph G {\n")
+	if err != nil {
+		return err
+	}
+
+	for _, edge := range edges {
+		_, err = w.WriteString(fmt.Sprintf("\"%s\"->\"%s\" [%s];\n", edge[0], edge[1], edgeStyles[edge]))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, node := range sortedNodes {
+		colour, ok := nodeColours[node]
+		if !ok {
+			colour = "black"
+		}
+
+		_, err = w.WriteString(fmt.Sprintf("\"%s\" [color=\"%s\"];\n", node, colour))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.WriteString("}\n")
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// fetched returns whether a request was made for the given page, i.e. whether it has a status or a fetch error.
+func fetched(n Node) bool {
+	return n.Crawled || n.Error != ""
+}
+
+// changed returns whether the contents of a page crawled twice changed, comparing the hashes of its visible text,
+// or its size and type if it isn't HTML (or was crawled before pages were hashed).
+func changed(before Node, after Node) bool {
+	if before.Hash != "" && after.Hash != "" {
+		return before.Hash != after.Hash
+	}
+
+	return before.Size != after.Size || before.ContentType != after.ContentType
+}
+
+// diffLinks returns the link targets which are only in after (added) and only in before (removed), sorted.
+func diffLinks(before []Edge, after []Edge) ([]string, []string) {
+	inOld := make(map[string]bool)
+	for _, e := range before {
+		inOld[string(e.To)] = true
+	}
+
+	inNew := make(map[string]bool)
+	for _, e := range after {
+		inNew[string(e.To)] = true
+	}
+
+	var added, removed []string
+
+	for l := range inNew {
+		if !inOld[l] {
+			added = append(added, l)
+		}
+	}
+
+	for l := range inOld {
+		if !inNew[l] {
+			removed = append(removed, l)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	return added, removed
+}
+
+func pagesToLines(prefix string, pages []CanonicalURL) []string {
+	var lines []string
+	for _, p := range pages {
+		lines = append(lines, prefix+string(p))
+	}
+
+	return lines
+}
+
+func linksToLines(prefix string, links map[CanonicalURL][]string) []string {
+	var pages []string
+	for p := range links {
+		pages = append(pages, string(p))
+	}
+	sort.Strings(pages)
+
+	var lines []string
+	for _, p := range pages {
+		for _, l := range links[CanonicalURL(p)] {
+			lines = append(lines, fmt.Sprintf("%s%s -> %s", prefix, p, l))
+		}
+	}
+
+	return lines
+}
+
+func statusChangesToLines(changes []StatusChange) []string {
+	var lines []string
+	for _, c := range changes {
+		lines = append(lines, fmt.Sprintf("%s: %s -> %s", c.Page, c.Old, c.New))
+	}
+
+	return lines
+}
+
+func brokenLinksToLines(links []LinkReport) []string {
+	var lines []string
+	for _, l := range links {
+		lines = append(lines, fmt.Sprintf("%s -> %s", l.Source, l.Target))
+	}
+
+	return lines
+}
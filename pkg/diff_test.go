@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func getTestSnapshots() (Snapshot, Snapshot) {
+	before := Snapshot{Sitemap: getTestSitemap()}
+	after := Snapshot{Sitemap: NewSitemap()}
+
+	for _, p := range []Page{
+		{Addr: "https://test.com", Links: Links{"https://test.com", "https://test.com/foo", "https://test.com/qux"}, Status: 200},
+		{Addr: "https://test.com/foo", Links: Links{"https://test.com/bar", "https://test.com/baz"}, Status: 200, Depth: 1},
+		{Addr: "https://test.com/baz", Status: 500, Depth: 2},
+		{Addr: "https://test.com/qux", Links: Links{"https://test.com/baz"}, Status: 200, Depth: 1},
+	} {
+		after.Sitemap.AddPage(p)
+	}
+
+	return before, after
+}
+
+func TestDiff(t *testing.T) {
+	d := Diff(getTestSnapshots())
+
+	if d.Empty() {
+		t.Error("Empty(): expected the diff not to be empty")
+	}
+
+	assertPages(t, "AddedPages", d.AddedPages, "https://test.com/qux")
+	assertPages(t, "RemovedPages", d.RemovedPages, "https://test.com/bar")
+
+	if len(d.AddedLinks) != 1 || strings.Join(d.AddedLinks["https://test.com"], " ") != "https://test.com/qux" {
+		t.Errorf("Diff(): expected https://test.com/qux to be the only added link, got %v", d.AddedLinks)
+	}
+
+	if len(d.RemovedLinks) != 1 || strings.Join(d.RemovedLinks["https://test.com"], " ") != "https://test.com/bar" {
+		t.Errorf("Diff(): expected https://test.com/bar to be the only removed link, got %v", d.RemovedLinks)
+	}
+
+	expectedChanges := []StatusChange{
+		{Page: "https://test.com/baz", Old: "200", New: "500"},
+		{Page: "https://test.com/foo", Old: "404", New: "200"},
+	}
+
+	if len(d.StatusChanges) != len(expectedChanges) || d.StatusChanges[0] != expectedChanges[0] || d.StatusChanges[1] != expectedChanges[1] {
+		t.Errorf("Diff(): expected status changes %v, got %v", expectedChanges, d.StatusChanges)
+	}
+
+	expectedBroken := []LinkReport{
+		{Source: "https://test.com/foo", Target: "https://test.com/baz"},
+		{Source: "https://test.com/qux", Target: "https://test.com/baz"},
+	}
+
+	if len(d.NewBrokenLinks) != len(expectedBroken) {
+		t.Errorf("Diff(): expected new broken links %v, got %v", expectedBroken, d.NewBrokenLinks)
+		t.FailNow()
+	}
+
+	for i := range expectedBroken {
+		if d.NewBrokenLinks[i] != expectedBroken[i] {
+			t.Errorf("Diff(): expected new broken links %v, got %v", expectedBroken, d.NewBrokenLinks)
+		}
+	}
+}
+
+func TestDiffOfIdenticalCrawls(t *testing.T) {
+	before, _ := getTestSnapshots()
+
+	d := Diff(before, before)
+
+	if !d.Empty() {
+		t.Errorf("Diff(): expected no changes, got %v", d)
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	actual, err := DiffText(Diff(getTestSnapshots()))
+	if err != nil {
+		t.Errorf("DiffText(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expectedLines := []string{
+		"added pages (1):",
+		"+ https://test.com/qux",
+		"removed pages (1):",
+		"- https://test.com/bar",
+		"+ https://test.com -> https://test.com/qux",
+		"- https://test.com -> https://test.com/bar",
+		"https://test.com/foo: 404 -> 200",
+		"new broken links (2):",
+		"https://test.com/qux -> https://test.com/baz",
+	}
+
+	for _, ll := range expectedLines {
+		if !strings.Contains(actual, ll) {
+			t.Errorf("DiffText(): expected output %s to contain line %s", actual, ll)
+		}
+	}
+}
+
+func TestDiffJSON(t *testing.T) {
+	actual, err := DiffJSON(Diff(getTestSnapshots()))
+	if err != nil {
+		t.Errorf("DiffJSON(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expected := []string{
+		`"addedPages": [`,
+		`"https://test.com/qux"`,
+		`"old": "404"`,
+		`"newBrokenLinks": [`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(actual, e) {
+			t.Errorf("DiffJSON(): expected output %s to contain %s", actual, e)
+		}
+	}
+}
+
+func TestWriteDiffDot(t *testing.T) {
+	var b bytes.Buffer
+
+	before, after := getTestSnapshots()
+
+	err := writeDiffDot(&b, before, after)
+	if err != nil {
+		t.Errorf("writeDiffDot(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	actual := b.String()
+
+	expectedLines := []string{
+		`"https://test.com"->"https://test.com/qux" [color="green"];`,
+		`"https://test.com"->"https://test.com/bar" [color="red",style="dashed"];`,
+		`"https://test.com"->"https://test.com/foo" [color="grey"];`,
+		`"https://test.com/qux" [color="green"];`,
+		`"https://test.com/bar" [color="red"];`,
+		`"https://test.com/foo" [color="orange"];`,
+		`"https://test.com" [color="black"];`,
+	}
+
+	for _, ll := range expectedLines {
+		if !strings.Contains(actual, ll) {
+			t.Errorf("writeDiffDot(): expected output %s to contain line %s", actual, ll)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	var tests = []struct {
+		before   Node
+		after    Node
+		expected bool
+	}{
+		{Node{Hash: "a", Size: 10}, Node{Hash: "a", Size: 20}, false},
+		{Node{Hash: "a"}, Node{Hash: "b"}, true},
+		{Node{ContentType: "application/pdf", Size: 10}, Node{ContentType: "application/pdf", Size: 10}, false},
+		{Node{ContentType: "application/pdf", Size: 10}, Node{ContentType: "application/pdf", Size: 20}, true},
+		{Node{ContentType: "text/html", Size: 10}, Node{ContentType: "text/html", Size: 10, Hash: "a"}, false},
+	}
+
+	for _, test := range tests {
+		actual := changed(test.before, test.after)
+		if actual != test.expected {
+			t.Errorf("changed(%v, %v): expected %v, got %v", test.before, test.after, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const (
+	// DefaultOutputFileGraphML is the .graphml file location to save the sitemap graph to.
+	DefaultOutputFileGraphML = "sitemap.graphml"
+
+	// DefaultOutputFileGEXF is the .gexf file location to save the sitemap graph to.
+	DefaultOutputFileGEXF = "sitemap.gexf"
+
+	// DefaultOutputFileNodesCSV is the .csv file location to save the sitemap node list to.
+	DefaultOutputFileNodesCSV = "sitemap-nodes.csv"
+
+	// DefaultOutputFileEdgesCSV is the .csv file location to save the sitemap edge list to.
+	DefaultOutputFileEdgesCSV = "sitemap-edges.csv"
+)
+
+// GraphML saves the given sitemap as a GraphML file, which can be loaded into tools such as yEd, Gephi or networkx.
+// Nodes carry the page details (status, depth, title and whether the page is external)
+// and edges carry the link details (rel and anchor text).
+func GraphML(s *Sitemap) error {
+	return export(DefaultOutputFileGraphML, s, writeGraphML)
+}
+
+// GEXF saves the given sitemap as a GEXF file, the native format of Gephi, with the same details as GraphML.
+func GEXF(s *Sitemap) error {
+	return export(DefaultOutputFileGEXF, s, writeGEXF)
+}
+
+// CSV saves the given sitemap as two CSV files: a node list and an edge list.
+func CSV(s *Sitemap) error {
+	err := export(DefaultOutputFileNodesCSV, s, writeNodesCSV)
+	if err != nil {
+		return err
+	}
+
+	return export(DefaultOutputFileEdgesCSV, s, writeEdgesCSV)
+}
+
+func export(file string, s *Sitemap, write func(io.Writer, *Sitemap) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("error creating the %s output file writer: %s", file, err.Error())
+	}
+
+	defer f.Close()
+
+	err = write(f, s)
+	if err != nil {
+		return fmt.Errorf("error generating the %s file: %s", file, err.Error())
+	}
+
+	return nil
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeGraphML(w io.Writer, s *Sitemap) error {
+	g := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "status", For: "node", Name: "status", Type: "int"},
+			{ID: "depth", For: "node", Name: "depth", Type: "int"},
+			{ID: "title", For: "node", Name: "title", Type: "string"},
+			{ID: "external", For: "node", Name: "external", Type: "boolean"},
+			{ID: "rel", For: "edge", Name: "rel", Type: "string"},
+			{ID: "text", For: "edge", Name: "text", Type: "string"},
+		},
+		Graph: graphMLGraph{ID: "sitemap", EdgeDefault: "directed"},
+	}
+
+	for _, node := range s.Nodes() {
+		n := graphMLNode{ID: string(node.URL)}
+		for _, attr := range nodeAttributes(node) {
+			n.Data = append(n.Data, graphMLData{Key: attr[0], Value: attr[1]})
+		}
+		g.Graph.Nodes = append(g.Graph.Nodes, n)
+	}
+
+	for _, edge := range s.Edges() {
+		e := graphMLEdge{Source: string(edge.From), Target: string(edge.To)}
+		for _, attr := range edgeAttributes(edge) {
+			e.Data = append(e.Data, graphMLData{Key: attr[0], Value: attr[1]})
+		}
+		g.Graph.Edges = append(g.Graph.Edges, e)
+	}
+
+	return writeXML(w, g)
+}
+
+type gexf struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfGraph struct {
+	Mode            string           `xml:"mode,attr"`
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID     string          `xml:"id,attr"`
+	Label  string          `xml:"label,attr"`
+	Values []gexfAttrValue `xml:"attvalues>attvalue,omitempty"`
+}
+
+type gexfEdge struct {
+	ID     string          `xml:"id,attr"`
+	Source string          `xml:"source,attr"`
+	Target string          `xml:"target,attr"`
+	Values []gexfAttrValue `xml:"attvalues>attvalue,omitempty"`
+}
+
+type gexfAttrValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func writeGEXF(w io.Writer, s *Sitemap) error {
+	g := gexf{
+		XMLNS:   "http://www.gexf.net/1.2draft",
+		Version: "1.2",
+		Graph: gexfGraph{
+			Mode:            "static",
+			DefaultEdgeType: "directed",
+			Attributes: []gexfAttributes{
+				{Class: "node", Attributes: []gexfAttribute{
+					{ID: "status", Title: "status", Type: "integer"},
+					{ID: "depth", Title: "depth", Type: "integer"},
+					{ID: "title", Title: "title", Type: "string"},
+					{ID: "external", Title: "external", Type: "boolean"},
+				}},
+				{Class: "edge", Attributes: []gexfAttribute{
+					{ID: "rel", Title: "rel", Type: "string"},
+					{ID: "text", Title: "text", Type: "string"},
+				}},
+			},
+		},
+	}
+
+	for _, node := range s.Nodes() {
+		n := gexfNode{ID: string(node.URL), Label: string(node.URL)}
+		for _, attr := range nodeAttributes(node) {
+			n.Values = append(n.Values, gexfAttrValue{For: attr[0], Value: attr[1]})
+		}
+		g.Graph.Nodes = append(g.Graph.Nodes, n)
+	}
+
+	for i, edge := range s.Edges() {
+		e := gexfEdge{ID: strconv.Itoa(i), Source: string(edge.From), Target: string(edge.To)}
+		for _, attr := range edgeAttributes(edge) {
+			e.Values = append(e.Values, gexfAttrValue{For: attr[0], Value: attr[1]})
+		}
+		g.Graph.Edges = append(g.Graph.Edges, e)
+	}
+
+	return writeXML(w, g)
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	err = enc.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func writeNodesCSV(w io.Writer, s *Sitemap) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"id", "status", "depth", "title", "external"})
+	if err != nil {
+		return err
+	}
+
+	for _, node := range s.Nodes() {
+		record := []string{string(node.URL), "", "", "", ""}
+		for _, attr := range nodeAttributes(node) {
+			switch attr[0] {
+			case "status":
+				record[1] = attr[1]
+			case "depth":
+				record[2] = attr[1]
+			case "title":
+				record[3] = attr[1]
+			case "external":
+				record[4] = attr[1]
+			}
+		}
+
+		err := cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeEdgesCSV(w io.Writer, s *Sitemap) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"source", "target", "rel", "text"})
+	if err != nil {
+		return err
+	}
+
+	for _, edge := range s.Edges() {
+		record := []string{string(edge.From), string(edge.To), "", ""}
+		for _, attr := range edgeAttributes(edge) {
+			switch attr[0] {
+			case "rel":
+				record[2] = attr[1]
+			case "text":
+				record[3] = attr[1]
+			}
+		}
+
+		err := cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// nodeAttributes returns the known attributes of the given node as key/value pairs.
+// Nodes which haven't been crawled or failed to be fetched have no status or title.
+func nodeAttributes(n Node) [][2]string {
+	var attrs [][2]string
+
+	if n.Status != 0 {
+		attrs = append(attrs, [2]string{"status", strconv.Itoa(n.Status)})
+	}
+
+	attrs = append(attrs, [2]string{"depth", strconv.Itoa(n.Depth)})
+
+	if n.Title != "" {
+		attrs = append(attrs, [2]string{"title", n.Title})
+	}
+
+	if n.External {
+		attrs = append(attrs, [2]string{"external", "true"})
+	}
+
+	return attrs
+}
+
+// edgeAttributes returns the known attributes of the given edge as key/value pairs.
+func edgeAttributes(e Edge) [][2]string {
+	var attrs [][2]string
+
+	if e.Rel != "" {
+		attrs = append(attrs, [2]string{"rel", e.Rel})
+	}
+
+	if e.Text != "" {
+		attrs = append(attrs, [2]string{"text", e.Text})
+	}
+
+	return attrs
+}
@@ -0,0 +1,204 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteGraphML(t *testing.T) {
+	var b bytes.Buffer
+
+	err := writeGraphML(&b, getTestSitemap())
+	if err != nil {
+		t.Errorf("writeGraphML(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	var g graphML
+	err = xml.Unmarshal(b.Bytes(), &g)
+	if err != nil {
+		t.Errorf("writeGraphML(): expected valid XML, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if len(g.Graph.Nodes) != 4 {
+		t.Errorf("writeGraphML(): expected 4 nodes, got %d", len(g.Graph.Nodes))
+	}
+
+	if len(g.Graph.Edges) != 6 {
+		t.Errorf("writeGraphML(): expected 6 edges, got %d", len(g.Graph.Edges))
+	}
+
+	actual := b.String()
+
+	expectedLines := []string{
+		`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`,
+		`<graph id="sitemap" edgedefault="directed">`,
+		`<node id="https://test.com/foo">`,
+		`<data key="status">404</data>`,
+		`<data key="depth">1</data>`,
+		`<data key="title">Foo &amp; friends</data>`,
+		`<edge source="https://test.com" target="https://test.com/foo">`,
+		`<data key="rel">nofollow</data>`,
+		`<data key="text">Go to foo</data>`,
+	}
+
+	for _, ll := range expectedLines {
+		if !strings.Contains(actual, ll) {
+			t.Errorf("writeGraphML(): expected output %s to contain line %s", actual, ll)
+		}
+	}
+}
+
+func TestWriteGEXF(t *testing.T) {
+	var b bytes.Buffer
+
+	err := writeGEXF(&b, getTestSitemap())
+	if err != nil {
+		t.Errorf("writeGEXF(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	var g gexf
+	err = xml.Unmarshal(b.Bytes(), &g)
+	if err != nil {
+		t.Errorf("writeGEXF(): expected valid XML, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if len(g.Graph.Nodes) != 4 {
+		t.Errorf("writeGEXF(): expected 4 nodes, got %d", len(g.Graph.Nodes))
+	}
+
+	if len(g.Graph.Edges) != 6 {
+		t.Errorf("writeGEXF(): expected 6 edges, got %d", len(g.Graph.Edges))
+	}
+
+	actual := b.String()
+
+	expectedLines := []string{
+		`<gexf xmlns="http://www.gexf.net/1.2draft" version="1.2">`,
+		`<node id="https://test.com/foo" label="https://test.com/foo">`,
+		`<attvalue for="status" value="404"></attvalue>`,
+		`<attvalue for="title" value="Foo &amp; friends"></attvalue>`,
+		`<attvalue for="rel" value="nofollow"></attvalue>`,
+		`<attvalue for="text" value="Go to foo"></attvalue>`,
+	}
+
+	for _, ll := range expectedLines {
+		if !strings.Contains(actual, ll) {
+			t.Errorf("writeGEXF(): expected output %s to contain line %s", actual, ll)
+		}
+	}
+}
+
+func TestWriteNodesCSV(t *testing.T) {
+	var b bytes.Buffer
+
+	err := writeNodesCSV(&b, getTestSitemap())
+	if err != nil {
+		t.Errorf("writeNodesCSV(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Errorf("writeNodesCSV(): expected valid CSV, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expected := [][]string{
+		{"id", "status", "depth", "title", "external"},
+		{"https://test.com", "200", "0", "Test", ""},
+		{"https://test.com/bar", "200", "1", "", ""},
+		{"https://test.com/baz", "200", "2", "", ""},
+		{"https://test.com/foo", "404", "1", "Foo & friends", ""},
+	}
+
+	if len(records) != len(expected) {
+		t.Errorf("writeNodesCSV(): expected %d records, got %d", len(expected), len(records))
+		t.Errorf("expected: %v", expected)
+		t.Errorf("actual: %v", records)
+		t.FailNow()
+	}
+
+	for i := range expected {
+		if strings.Join(records[i], ",") != strings.Join(expected[i], ",") {
+			t.Errorf("writeNodesCSV(): expected record %d to be %v, got %v", i, expected[i], records[i])
+		}
+	}
+}
+
+func TestWriteEdgesCSV(t *testing.T) {
+	var b bytes.Buffer
+
+	err := writeEdgesCSV(&b, getTestSitemap())
+	if err != nil {
+		t.Errorf("writeEdgesCSV(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Errorf("writeEdgesCSV(): expected valid CSV, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if len(records) != 7 {
+		t.Errorf("writeEdgesCSV(): expected 7 records (header and 6 edges), got %d", len(records))
+		t.FailNow()
+	}
+
+	expected := []string{"https://test.com", "https://test.com/foo", "nofollow", "Go to foo"}
+
+	found := false
+	for _, r := range records {
+		if strings.Join(r, ",") == strings.Join(expected, ",") {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("writeEdgesCSV(): expected %v to contain record %v", records, expected)
+	}
+}
+
+func TestWriteGraphMLReturnsErrorsFromWriter(t *testing.T) {
+	expected := errors.New("io.Writer error")
+
+	err := writeGraphML(errWriter{err: expected}, getTestSitemap())
+	if err == nil {
+		t.Errorf("writeGraphML(errWriter): expected error %s to be returned, got no error", expected.Error())
+		t.FailNow()
+	}
+
+	if err.Error() != expected.Error() {
+		t.Errorf("writeGraphML(errWriter): expected to get error %s, got %s", expected.Error(), err.Error())
+	}
+}
+
+func TestWriteNodesCSVIncludesExternalPages(t *testing.T) {
+	s := NewSitemap()
+	s.AddPage(Page{
+		Addr:     CanonicalURL("https://test.com"),
+		Status:   200,
+		External: Links{"https://other.com"},
+	})
+
+	var b bytes.Buffer
+
+	err := writeNodesCSV(&b, s)
+	if err != nil {
+		t.Errorf("writeNodesCSV(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expected := "https://other.com,,1,,true\n"
+	if !strings.Contains(b.String(), expected) {
+		t.Errorf("writeNodesCSV(): expected output %s to contain %s", b.String(), expected)
+	}
+}
@@ -17,9 +17,9 @@ const (
 	DefaultOutputFileSvg = "sitemap.svg"
 )
 
-// Text renders the given sitemap as a list of pages and links found.
-func Text(s Sitemap) (string, error) {
-	edges := getEdges(s)
+// Text renders the given sitemap as a list of the pages crawled and the links found between pages on the site.
+func Text(s *Sitemap) (string, error) {
+	s = s.Internal()
 
 	var buffer bytes.Buffer
 
@@ -28,8 +28,8 @@ func Text(s Sitemap) (string, error) {
 		return "", fmt.Errorf("error generating the text output: %s", err.Error())
 	}
 
-	for url := range s {
-		_, err := buffer.WriteString(string(url) + "\n")
+	for _, page := range s.Pages() {
+		_, err := buffer.WriteString(string(page.URL) + "\n")
 		if err != nil {
 			return "", fmt.Errorf("error writing the page list: %s", err.Error())
 		}
@@ -40,8 +40,8 @@ func Text(s Sitemap) (string, error) {
 		return "", fmt.Errorf("error generating the text output: %s", err.Error())
 	}
 
-	for _, edge := range edges {
-		_, err := buffer.WriteString(fmt.Sprintf("%s -> %s\n", edge[0], edge[1]))
+	for _, edge := range s.Edges() {
+		_, err := buffer.WriteString(fmt.Sprintf("%s -> %s\n", edge.From, edge.To))
 		if err != nil {
 			return "", fmt.Errorf("error writing the links: %s", err.Error())
 		}
@@ -54,7 +54,8 @@ func Text(s Sitemap) (string, error) {
 // The graph is generated using dot, a graphviz tool.
 // The dot command is invoked using the exec command, and it is assumed that dot is already installed.
 // The sitemap data is first saved as a .dot file, which is then passed as source to the dot command.
-func Graph(s Sitemap) error {
+// External pages are left out of the graph.
+func Graph(s *Sitemap) error {
 	f, err := os.Create(DefaultOutputFileDot)
 	if err != nil {
 		return fmt.Errorf("error creating the .dot output file writer: %s", err.Error())
@@ -67,8 +68,13 @@ func Graph(s Sitemap) error {
 		return fmt.Errorf("error generating the dot file: %s", err.Error())
 	}
 
-	cmd := exec.Command("dot", "-Tsvg", DefaultOutputFileDot, "-o", DefaultOutputFileSvg)
-	err = cmd.Run()
+	return runDot(DefaultOutputFileDot, DefaultOutputFileSvg)
+}
+
+// runDot renders the given .dot file as an SVG file using the dot command.
+func runDot(dotFile string, svgFile string) error {
+	cmd := exec.Command("dot", "-Tsvg", dotFile, "-o", svgFile)
+	err := cmd.Run()
 	if err != nil {
 		return fmt.Errorf("error generating the svg file: %s", err.Error())
 	}
@@ -76,9 +82,9 @@ func Graph(s Sitemap) error {
 	return nil
 }
 
-func writeDot(writer io.Writer, sitemap Sitemap) (err error) {
+func writeDot(writer io.Writer, sitemap *Sitemap) (err error) {
 
-	edges := getEdges(sitemap)
+	sitemap = sitemap.Internal()
 
 	w := bufio.NewWriter(writer)
 
@@ -87,8 +93,8 @@ func writeDot(writer io.Writer, sitemap Sitemap) (err error) {
 		return err
 	}
 
-	for _, edge := range edges {
-		_, err = w.WriteString(fmt.Sprintf(`"%s"->"%s";`, edge[0], edge[1]))
+	for _, edge := range sitemap.Edges() {
+		_, err = w.WriteString(fmt.Sprintf(`"%s"->"%s";`, edge.From, edge.To))
 		if err != nil {
 			return err
 		}
@@ -99,8 +105,8 @@ func writeDot(writer io.Writer, sitemap Sitemap) (err error) {
 		}
 	}
 
-	for url := range sitemap {
-		_, err := w.WriteString(fmt.Sprintf(`"%s";`, url))
+	for _, page := range sitemap.Pages() {
+		_, err := w.WriteString(fmt.Sprintf(`"%s";`, page.URL))
 		if err != nil {
 			return err
 		}
@@ -123,15 +129,3 @@ func writeDot(writer io.Writer, sitemap Sitemap) (err error) {
 
 	return nil
 }
-
-func getEdges(sitemap Sitemap) [][2]string {
-	var edges [][2]string
-
-	for page, links := range sitemap {
-		for _, link := range links {
-			edges = append(edges, [2]string{string(page), link})
-		}
-	}
-
-	return edges
-}
@@ -7,45 +7,6 @@ import (
 	"testing"
 )
 
-func TestGetEdges(t *testing.T) {
-
-	result := getEdges(getTestSitemap())
-
-	expected := [][]string{
-		{"https://test.com", "https://test.com"},
-		{"https://test.com", "https://test.com/foo"},
-		{"https://test.com", "https://test.com/bar"},
-		{"https://test.com/foo", "https://test.com/bar"},
-		{"https://test.com/foo", "https://test.com/baz"},
-		{"https://test.com/bar", "https://test.com/foo"},
-	}
-
-	if len(result) != len(expected) {
-		t.Errorf("getEdges(): expected to have %d edges, got %d edges", len(expected), len(result))
-		t.Errorf("expected: %v", expected)
-		t.Errorf("actual: %v", result)
-		t.FailNow()
-	}
-
-	allEdgesFound := true
-	for _, ii := range expected {
-		found := false
-		for _, jj := range result {
-			if ii[0] == jj[0] && ii[1] == jj[1] || ii[0] == jj[1] && ii[1] == jj[0] {
-				found = true
-			}
-		}
-		if !found {
-			t.Errorf("getEdges(): expected %v\nto contain %v", result, ii)
-			allEdgesFound = false
-		}
-	}
-
-	if !allEdgesFound {
-		t.Fail()
-	}
-}
-
 func TestText(t *testing.T) {
 	actual, err := Text(getTestSitemap())
 
@@ -137,17 +98,43 @@ func TestWriteDotReturnsErrorsFromWriter(t *testing.T) {
 	}
 }
 
-func getTestSitemap() Sitemap {
-	s := Sitemap{}
-
-	l1 := Links{"https://test.com", "https://test.com/foo", "https://test.com/bar"}
-	l2 := Links{"https://test.com/bar", "https://test.com/baz"}
-	l3 := Links{"https://test.com/foo"}
+func getTestSitemap() *Sitemap {
+	s := NewSitemap()
 
-	s[CanonicalURL("https://test.com")] = l1
-	s[CanonicalURL("https://test.com/foo")] = l2
-	s[CanonicalURL("https://test.com/bar")] = l3
-	s[CanonicalURL("https://test.com/baz")] = Links{}
+	for _, p := range getTestPages() {
+		s.AddPage(p)
+	}
 
 	return s
 }
+
+func getTestPages() []Page {
+	return []Page{
+		{
+			Addr:    CanonicalURL("https://test.com"),
+			Links:   Links{"https://test.com", "https://test.com/foo", "https://test.com/bar"},
+			Status:  200,
+			Title:   "Test",
+			Depth:   0,
+			Anchors: map[string]Anchor{"https://test.com/foo": {Rel: "nofollow", Text: "Go to foo"}},
+		},
+		{
+			Addr:   CanonicalURL("https://test.com/foo"),
+			Links:  Links{"https://test.com/bar", "https://test.com/baz"},
+			Status: 404,
+			Title:  "Foo & friends",
+			Depth:  1,
+		},
+		{
+			Addr:   CanonicalURL("https://test.com/bar"),
+			Links:  Links{"https://test.com/foo"},
+			Status: 200,
+			Depth:  1,
+		},
+		{
+			Addr:   CanonicalURL("https://test.com/baz"),
+			Status: 200,
+			Depth:  2,
+		},
+	}
+}
@@ -0,0 +1,329 @@
+package crawler
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// DefaultOutputFileHTML is the .html file location to save the interactive sitemap report to.
+const DefaultOutputFileHTML = "sitemap.html"
+
+// HTML saves the given sitemap as a single-file interactive HTML report, which can be opened in any browser.
+// The report contains a force-directed graph of the pages (click a page to list its inbound and outbound links),
+// and searchable, sortable tables of the pages and links.
+// External pages are shown in a different colour.
+func HTML(s *Sitemap) error {
+	return export(DefaultOutputFileHTML, s, writeHTML)
+}
+
+// htmlReportNode is a single page in the HTML report.
+// Crawled is false for link targets which haven't been crawled (e.g. because of the max depth).
+type htmlReportNode struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Depth    int    `json:"depth"`
+	Title    string `json:"title"`
+	Crawled  bool   `json:"crawled"`
+	External bool   `json:"external"`
+}
+
+type htmlReportLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Rel    string `json:"rel"`
+	Text   string `json:"text"`
+}
+
+type htmlReportData struct {
+	Nodes []htmlReportNode `json:"nodes"`
+	Links []htmlReportLink `json:"links"`
+}
+
+func writeHTML(w io.Writer, s *Sitemap) error {
+	data := htmlReportData{Nodes: []htmlReportNode{}, Links: []htmlReportLink{}}
+
+	for _, node := range s.Nodes() {
+		data.Nodes = append(data.Nodes, htmlReportNode{
+			ID:       string(node.URL),
+			Status:   statusText(node),
+			Depth:    node.Depth,
+			Title:    node.Title,
+			Crawled:  node.Crawled,
+			External: node.External,
+		})
+	}
+
+	for _, edge := range s.Edges() {
+		data.Links = append(data.Links, htmlReportLink{Source: string(edge.From), Target: string(edge.To), Rel: edge.Rel, Text: edge.Text})
+	}
+
+	err := htmlReportTemplate.Execute(w, data)
+	if err != nil {
+		return fmt.Errorf("error executing the html template: %s", err.Error())
+	}
+
+	return nil
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Sitemap report</title>
+<style>
+body { font-family: sans-serif; margin: 0; color: #222; }
+header { padding: 12px 20px; background: #f4f4f4; border-bottom: 1px solid #ddd; }
+h1 { font-size: 20px; margin: 0; }
+h2 { font-size: 16px; }
+section { padding: 0 20px 20px; }
+#graph-container { display: flex; height: 600px; border-bottom: 1px solid #ddd; }
+#graph { flex: 1; cursor: grab; }
+#details { width: 380px; overflow: auto; padding: 0 12px; border-left: 1px solid #ddd; font-size: 13px; }
+#details li { cursor: pointer; word-break: break-all; }
+#details li:hover { text-decoration: underline; }
+.node { stroke: #fff; stroke-width: 1.5px; cursor: pointer; }
+.node.selected { stroke: #000; stroke-width: 3px; }
+.link { stroke: #999; stroke-opacity: 0.5; }
+.link.highlighted { stroke: #d62728; stroke-opacity: 1; }
+table { border-collapse: collapse; width: 100%; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 4px 6px; text-align: left; word-break: break-all; }
+th { background: #f4f4f4; cursor: pointer; user-select: none; }
+input[type=search] { width: 300px; padding: 4px; margin-bottom: 8px; }
+</style>
+</head>
+<body>
+<header><h1>Sitemap report</h1><span id="summary"></span></header>
+<div id="graph-container">
+<svg id="graph"><g id="viewport"><g id="links"></g><g id="nodes"></g></g></svg>
+<div id="details"><h2>Select a page</h2><p>Click a node in the graph or a page in the table to see its inbound and outbound links. Scroll to zoom, drag to pan.</p></div>
+</div>
+<section>
+<h2>Pages</h2>
+<input type="search" id="pages-search" placeholder="Search pages">
+<table id="pages"><thead><tr><th data-key="id">Page</th><th data-key="status">Status</th><th data-key="depth">Depth</th><th data-key="title">Title</th><th data-key="inbound">Inbound</th><th data-key="outbound">Outbound</th></tr></thead><tbody></tbody></table>
+<h2>Links</h2>
+<input type="search" id="links-search" placeholder="Search links">
+<table id="links-table"><thead><tr><th data-key="source">Found on</th><th data-key="target">Link</th><th data-key="rel">Rel</th><th data-key="text">Anchor text</th></tr></thead><tbody></tbody></table>
+</section>
+<script>
+(function() {
+  var data = {{.}};
+  var svgNS = "http://www.w3.org/2000/svg";
+  var byID = {};
+
+  data.nodes.forEach(function(n, i) {
+    n.inbound = [];
+    n.outbound = [];
+    var angle = i * 2.399963;
+    var radius = 10 * Math.sqrt(i + 1);
+    n.x = Math.cos(angle) * radius;
+    n.y = Math.sin(angle) * radius;
+    n.vx = 0;
+    n.vy = 0;
+    byID[n.id] = n;
+  });
+
+  data.links.forEach(function(l) {
+    byID[l.source].outbound.push(l);
+    byID[l.target].inbound.push(l);
+  });
+
+  data.nodes.forEach(function(n) {
+    n.inboundCount = n.inbound.length;
+    n.outboundCount = n.outbound.length;
+  });
+
+  document.getElementById("summary").textContent =
+    data.nodes.length + " pages, " + data.links.length + " links";
+
+  function colour(n) {
+    if (n.external) { return "#9467bd"; }
+    if (!n.crawled) { return "#bbb"; }
+    if (n.status.indexOf("error") === 0 || parseInt(n.status, 10) >= 400) { return "#d62728"; }
+    if (parseInt(n.status, 10) >= 300) { return "#ff7f0e"; }
+    return "#1f77b4";
+  }
+
+  // Graph
+  var svg = document.getElementById("graph");
+  var linkEls = data.links.map(function(l) {
+    var el = document.createElementNS(svgNS, "line");
+    el.setAttribute("class", "link");
+    document.getElementById("links").appendChild(el);
+    return el;
+  });
+  var nodeEls = data.nodes.map(function(n) {
+    var el = document.createElementNS(svgNS, "circle");
+    el.setAttribute("class", "node");
+    el.setAttribute("r", 4 + Math.min(8, Math.sqrt(n.inbound.length) * 2));
+    el.setAttribute("fill", colour(n));
+    var title = document.createElementNS(svgNS, "title");
+    title.textContent = n.id + (n.title ? "\n" + n.title : "");
+    el.appendChild(title);
+    el.addEventListener("click", function(e) { e.stopPropagation(); select(n); });
+    document.getElementById("nodes").appendChild(el);
+    return el;
+  });
+
+  function tick(alpha) {
+    var i, j, a, b, dx, dy, d2, d, f;
+    for (i = 0; i < data.nodes.length; i++) {
+      a = data.nodes[i];
+      for (j = i + 1; j < data.nodes.length; j++) {
+        b = data.nodes[j];
+        dx = b.x - a.x; dy = b.y - a.y;
+        d2 = dx * dx + dy * dy || 0.01;
+        f = 300 * alpha / d2;
+        a.vx -= dx * f; a.vy -= dy * f;
+        b.vx += dx * f; b.vy += dy * f;
+      }
+      a.vx -= a.x * 0.01 * alpha;
+      a.vy -= a.y * 0.01 * alpha;
+    }
+    data.links.forEach(function(l) {
+      a = byID[l.source]; b = byID[l.target];
+      if (a === b) { return; }
+      dx = b.x - a.x; dy = b.y - a.y;
+      d = Math.sqrt(dx * dx + dy * dy) || 0.01;
+      f = (d - 50) / d * 0.05 * alpha;
+      a.vx += dx * f; a.vy += dy * f;
+      b.vx -= dx * f; b.vy -= dy * f;
+    });
+    data.nodes.forEach(function(n) {
+      n.vx *= 0.6; n.vy *= 0.6;
+      n.x += n.vx; n.y += n.vy;
+    });
+  }
+
+  function draw() {
+    data.links.forEach(function(l, i) {
+      linkEls[i].setAttribute("x1", byID[l.source].x);
+      linkEls[i].setAttribute("y1", byID[l.source].y);
+      linkEls[i].setAttribute("x2", byID[l.target].x);
+      linkEls[i].setAttribute("y2", byID[l.target].y);
+    });
+    data.nodes.forEach(function(n, i) {
+      nodeEls[i].setAttribute("cx", n.x);
+      nodeEls[i].setAttribute("cy", n.y);
+    });
+  }
+
+  var view = { x: 0, y: 0, scale: 1 };
+  function applyView() {
+    var rect = svg.getBoundingClientRect();
+    document.getElementById("viewport").setAttribute("transform",
+      "translate(" + (rect.width / 2 + view.x) + "," + (rect.height / 2 + view.y) + ") scale(" + view.scale + ")");
+  }
+
+  svg.addEventListener("wheel", function(e) {
+    e.preventDefault();
+    view.scale *= e.deltaY < 0 ? 1.1 : 1 / 1.1;
+    applyView();
+  });
+
+  var drag = null;
+  svg.addEventListener("mousedown", function(e) { drag = { x: e.clientX - view.x, y: e.clientY - view.y }; });
+  window.addEventListener("mousemove", function(e) {
+    if (drag) { view.x = e.clientX - drag.x; view.y = e.clientY - drag.y; applyView(); }
+  });
+  window.addEventListener("mouseup", function() { drag = null; });
+  window.addEventListener("resize", applyView);
+
+  var alpha = 1;
+  function animate() {
+    tick(alpha);
+    draw();
+    alpha *= 0.99;
+    if (alpha > 0.01) { window.requestAnimationFrame(animate); }
+  }
+  applyView();
+  animate();
+
+  // Details panel
+  function linkList(title, links, key) {
+    var h = document.createElement("h3");
+    h.textContent = title + " (" + links.length + ")";
+    var ul = document.createElement("ul");
+    links.forEach(function(l) {
+      var li = document.createElement("li");
+      li.textContent = l[key] + (l.text ? " – “" + l.text + "”" : "");
+      li.addEventListener("click", function() { select(byID[l[key]]); });
+      ul.appendChild(li);
+    });
+    return [h, ul];
+  }
+
+  function select(n) {
+    nodeEls.forEach(function(el, i) { el.classList.toggle("selected", data.nodes[i] === n); });
+    linkEls.forEach(function(el, i) {
+      var l = data.links[i];
+      el.classList.toggle("highlighted", l.source === n.id || l.target === n.id);
+    });
+
+    var details = document.getElementById("details");
+    details.innerHTML = "";
+    var h = document.createElement("h2");
+    h.textContent = n.id;
+    details.appendChild(h);
+    var p = document.createElement("p");
+    p.textContent = (n.title || "(no title)") + " – status " + (n.status || "unknown") + ", depth " + n.depth;
+    details.appendChild(p);
+    linkList("Inbound links", n.inbound, "source").concat(linkList("Outbound links", n.outbound, "target"))
+      .forEach(function(el) { details.appendChild(el); });
+  }
+
+  // Tables
+  function table(id, searchID, rows, keys, onClick) {
+    var tbody = document.querySelector("#" + id + " tbody");
+    var sortKey = null, sortDir = 1;
+
+    function render() {
+      var q = document.getElementById(searchID).value.toLowerCase();
+      var filtered = rows.filter(function(r) {
+        return !q || keys.some(function(k) { return String(r[k]).toLowerCase().indexOf(q) !== -1; });
+      });
+      if (sortKey) {
+        filtered.sort(function(a, b) {
+          var x = a[sortKey], y = b[sortKey];
+          return (x < y ? -1 : x > y ? 1 : 0) * sortDir;
+        });
+      }
+      tbody.innerHTML = "";
+      filtered.forEach(function(r) {
+        var tr = document.createElement("tr");
+        keys.forEach(function(k) {
+          var td = document.createElement("td");
+          td.textContent = r[k];
+          tr.appendChild(td);
+        });
+        if (onClick) {
+          tr.style.cursor = "pointer";
+          tr.addEventListener("click", function() { onClick(r); window.scrollTo(0, 0); });
+        }
+        tbody.appendChild(tr);
+      });
+    }
+
+    document.querySelectorAll("#" + id + " th").forEach(function(th) {
+      th.addEventListener("click", function() {
+        var key = th.getAttribute("data-key");
+        sortDir = sortKey === key ? -sortDir : 1;
+        sortKey = key;
+        render();
+      });
+    });
+    document.getElementById(searchID).addEventListener("input", render);
+    render();
+  }
+
+  table("pages", "pages-search", data.nodes.map(function(n) {
+    return { id: n.id, status: n.status, depth: n.depth, title: n.title, inbound: n.inboundCount, outbound: n.outboundCount, node: n };
+  }), ["id", "status", "depth", "title", "inbound", "outbound"], function(r) { select(r.node); });
+
+  table("links-table", "links-search", data.links, ["source", "target", "rel", "text"], null);
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+	var b bytes.Buffer
+
+	s := getTestSitemap()
+	s.AddEdge(Edge{From: CanonicalURL("https://test.com/baz"), To: CanonicalURL("https://test.com"), Text: "</script><script>alert(1)</script>"})
+
+	err := writeHTML(&b, s)
+	if err != nil {
+		t.Errorf("writeHTML(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	actual := b.String()
+
+	expected := []string{
+		"<!DOCTYPE html>",
+		`{"id":"https://test.com","status":"200","depth":0,"title":"Test","crawled":true,"external":false}`,
+		`{"id":"https://test.com/foo","status":"404","depth":1,"title":"Foo \u0026 friends","crawled":true,"external":false}`,
+		`{"source":"https://test.com","target":"https://test.com/foo","rel":"nofollow","text":"Go to foo"}`,
+		`{"source":"https://test.com/foo","target":"https://test.com/baz","rel":"","text":""}`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(actual, e) {
+			t.Errorf("writeHTML(): expected output to contain %s", e)
+		}
+	}
+
+	if strings.Count(actual, "</script>") != 1 {
+		t.Errorf("writeHTML(): expected the embedded data to be escaped, got %s", actual)
+	}
+}
+
+func TestWriteHTMLReturnsErrorsFromWriter(t *testing.T) {
+	err := writeHTML(errWriter{err: errors.New("io.Writer error")}, getTestSitemap())
+	if err == nil {
+		t.Error("writeHTML(errWriter): expected an error to be returned, got no error")
+	}
+}
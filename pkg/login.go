@@ -0,0 +1,315 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Login describes how to log in to the crawled site before crawling it. The cookies set when logging in are kept
+// in the cookie jar and sent with every request, and the Parser logs in again whenever the session expires,
+// i.e. when a page redirects to the login page or is refused with a 401 status.
+//
+// Page is the login page, which pages redirect to once the session has expired. To submit its login form, set the
+// fields to fill in Form (e.g. the username and password). The form is fetched first, so that hidden fields such as
+// CSRF tokens are sent back along with them, and it's sent to its own action, or to URL if it's set.
+//
+// To POST to a login endpoint instead, set URL along with Body, which is sent as it is (as JSON, unless ContentType
+// says otherwise). Page can still be set to detect expired sessions. If only URL and Form are set, the fields in Form
+// are POSTed to URL form-encoded.
+type Login struct {
+	Page        string
+	URL         string
+	Form        map[string]string
+	Body        string
+	ContentType string
+}
+
+// errLoginForm is returned when the login page holds no form.
+var errLoginForm = errors.New("no form found on the login page")
+
+// validate checks the login can be performed.
+func (l *Login) validate() error {
+	if l.Page == "" && l.URL == "" {
+		return errors.New("a login page or a login URL is required")
+	}
+
+	if l.Body != "" && l.URL == "" {
+		return errors.New("a login URL is required to send a login body")
+	}
+
+	if l.Body != "" && len(l.Form) > 0 {
+		return errors.New("a login body can't be sent along with form fields")
+	}
+
+	for _, u := range []string{l.Page, l.URL} {
+		if u == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("invalid login URL %q", u)
+		}
+	}
+
+	return nil
+}
+
+// isLoginPage returns whether the given URL is the login page (or the login URL), ignoring its query.
+func (l *Login) isLoginPage(u *url.URL) bool {
+	if l == nil {
+		return false
+	}
+
+	for _, login := range []string{l.Page, l.URL} {
+		if login == "" {
+			continue
+		}
+
+		parsed, err := url.Parse(login)
+		if err != nil {
+			continue
+		}
+
+		if parsed.Host == u.Host && strings.TrimSuffix(parsed.Path, "/") == strings.TrimSuffix(u.Path, "/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// login logs in as described by the fetch options, keeping the session cookies in the cookie jar.
+// The login requests bypass the cache, so that every login gets a fresh form (e.g. with a new CSRF token) and session.
+// When offline, pages are only served from the cache, so the Parser doesn't log in. The login requests are sent
+// with the given context, so that cancelling the crawl interrupts them.
+func (p *Parser) login(ctx context.Context) error {
+	l := p.opts.Login
+	if l == nil {
+		return nil
+	}
+
+	err := l.validate()
+	if err != nil {
+		return fmt.Errorf("error logging in: %s", err.Error())
+	}
+
+	if p.opts.Cache.isOffline() {
+		log.Printf("offline, not logging in")
+		p.loggedIn = true
+		return nil
+	}
+
+	client := &http.Client{Timeout: p.timeout(), Transport: p.transport(nil), Jar: p.opts.Jar}
+
+	var req *http.Request
+
+	switch {
+	case l.Body != "":
+		contentType := l.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, l.URL, strings.NewReader(l.Body))
+		if err == nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+	case l.Page != "":
+		req, err = p.loginForm(ctx, client, l)
+	default:
+		req, err = formRequest(ctx, http.MethodPost, l.URL, fields(l.Form))
+	}
+
+	if err != nil {
+		return fmt.Errorf("error logging in: %s", err.Error())
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error logging in: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("error logging in: %s returned status %d", req.URL, resp.StatusCode)
+	}
+
+	// Being sent back to the login page means the credentials were refused.
+	if resp.Request.URL.String() != req.URL.String() && l.isLoginPage(resp.Request.URL) {
+		return fmt.Errorf("error logging in: redirected back to the login page %s", resp.Request.URL)
+	}
+
+	log.Printf("logged in with %s", req.URL)
+	p.loggedIn = true
+
+	return nil
+}
+
+// loginForm fetches the login page, and returns the request submitting its form filled with the given fields.
+func (p *Parser) loginForm(ctx context.Context, client *http.Client, l *Login) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.Page, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("login page %s returned status %d", l.Page, resp.StatusCode)
+	}
+
+	f, err := readForm(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	action := l.URL
+	if action == "" {
+		a, err := resp.Request.URL.Parse(f.action)
+		if err != nil {
+			return nil, fmt.Errorf("invalid login form action %q", f.action)
+		}
+		action = a.String()
+	}
+
+	for name, value := range l.Form {
+		f.values.Set(name, value)
+	}
+
+	return formRequest(ctx, f.method, action, f.values)
+}
+
+// form is an HTML form, with the values of its fields.
+type form struct {
+	action   string
+	method   string
+	values   url.Values
+	password bool
+}
+
+// readForm returns the login form of the given page: the first form with a password field, or else the first form.
+func readForm(r io.Reader) (form, error) {
+	var forms []form
+	var current *form
+
+	z := html.NewTokenizer(r)
+
+	for {
+		tt := z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			if len(forms) == 0 {
+				return form{}, errLoginForm
+			}
+
+			for _, f := range forms {
+				if f.password {
+					return f, nil
+				}
+			}
+
+			return forms[0], nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+
+			switch t.Data {
+			case "form":
+				forms = append(forms, form{method: http.MethodGet, values: url.Values{}})
+				current = &forms[len(forms)-1]
+
+				for _, a := range t.Attr {
+					switch a.Key {
+					case "action":
+						current.action = a.Val
+					case "method":
+						if a.Val != "" {
+							current.method = strings.ToUpper(a.Val)
+						}
+					}
+				}
+			case "input":
+				if current == nil {
+					continue
+				}
+
+				var name, value, kind string
+				var checked bool
+				for _, a := range t.Attr {
+					switch a.Key {
+					case "name":
+						name = a.Val
+					case "value":
+						value = a.Val
+					case "type":
+						kind = strings.ToLower(a.Val)
+					case "checked":
+						checked = true
+					}
+				}
+
+				if kind == "password" {
+					current.password = true
+				}
+
+				// Buttons are only sent when clicked, and unchecked boxes never are.
+				skip := kind == "submit" || kind == "button" || kind == "image" || kind == "reset" ||
+					((kind == "checkbox" || kind == "radio") && !checked)
+
+				if name != "" && !skip {
+					current.values.Set(name, value)
+				}
+			}
+		case html.EndTagToken:
+			t := z.Token()
+			if t.Data == "form" {
+				current = nil
+			}
+		}
+	}
+}
+
+// formRequest returns the request submitting the given values, in the query of GET requests or as the body otherwise.
+func formRequest(ctx context.Context, method string, action string, values url.Values) (*http.Request, error) {
+	if method == http.MethodGet {
+		u, err := url.Parse(action)
+		if err != nil {
+			return nil, err
+		}
+		u.RawQuery = values.Encode()
+
+		return http.NewRequestWithContext(ctx, method, u.String(), nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, action, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return req, nil
+}
+
+// fields returns the given form fields as url values.
+func fields(form map[string]string) url.Values {
+	values := url.Values{}
+	for name, value := range form {
+		values.Set(name, value)
+	}
+
+	return values
+}
@@ -0,0 +1,235 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loginSite is a test site whose pages require a session, started by submitting the login form with a valid CSRF token
+// or by POSTing JSON credentials to /api/login. Expiring the sessions makes every page redirect to the login form.
+type loginSite struct {
+	mutex    sync.Mutex
+	sessions map[string]bool
+	logins   int
+}
+
+func (s *loginSite) expire() {
+	s.mutex.Lock()
+	s.sessions = make(map[string]bool)
+	s.mutex.Unlock()
+}
+
+func (s *loginSite) start(w http.ResponseWriter) {
+	s.mutex.Lock()
+	s.logins++
+	session := fmt.Sprintf("session-%d", s.logins)
+	s.sessions[session] = true
+	s.mutex.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: "session", Value: session, Path: "/"})
+}
+
+func (s *loginSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/login":
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `<form action="/search"><input name="q"></form>
+				<form action="/login" method="post">
+					<input type="hidden" name="csrf" value="token">
+					<input name="username"><input type="password" name="password">
+					<input type="checkbox" name="remember"><input type="submit" name="go" value="Log in">
+				</form>`)
+			return
+		}
+
+		r.ParseForm()
+		if r.PostForm.Get("csrf") != "token" || r.PostForm.Get("username") != "admin" || r.PostForm.Get("password") != "secret" ||
+			len(r.PostForm) != 3 {
+			http.Redirect(w, r, "/login?error=1", http.StatusFound)
+			return
+		}
+
+		s.start(w)
+		http.Redirect(w, r, "/", http.StatusFound)
+	case "/api/login":
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/json" || string(body) != `{"username":"admin","password":"secret"}` {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		s.start(w)
+	case "/about":
+		fmt.Fprint(w, `<p>No login required</p>`)
+	default:
+		c, err := r.Cookie("session")
+
+		s.mutex.Lock()
+		valid := err == nil && s.sessions[c.Value]
+		s.mutex.Unlock()
+
+		if !valid {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		fmt.Fprint(w, `<a href="/page">page</a><a href="/login">log out</a>`)
+	}
+}
+
+func getLoginSite(t *testing.T) (*loginSite, *httptest.Server) {
+	site := &loginSite{sessions: make(map[string]bool)}
+	return site, httptest.NewServer(site)
+}
+
+func TestParseLogsIn(t *testing.T) {
+	creds := map[string]string{"username": "admin", "password": "secret"}
+
+	var tests = []struct {
+		name  string
+		login func(base string) *Login
+	}{
+		{"form", func(base string) *Login { return &Login{Page: base + "/login", Form: creds} }},
+		{"endpoint", func(base string) *Login {
+			return &Login{Page: base + "/login", URL: base + "/api/login", Body: `{"username":"admin","password":"secret"}`}
+		}},
+	}
+
+	for _, test := range tests {
+		site, ts := getLoginSite(t)
+
+		u, _ := url.Parse(ts.URL)
+
+		p := NewParser(u.Scheme, u.Host)
+		p.SetFetchOptions(FetchOptions{Login: test.login(ts.URL)})
+
+		page, err := p.parse(context.TODO(), ts.URL+"/")
+		if err != nil {
+			t.Errorf("%s: parse(): expected no error returned, got %s", test.name, err.Error())
+			t.FailNow()
+		}
+
+		if page.Status != http.StatusOK || page.RedirectedFrom != "" {
+			t.Errorf("%s: parse(): expected the page to be fetched without redirects, got status %d from %q", test.name, page.Status, page.RedirectedFrom)
+		}
+
+		// The link to the login page isn't followed, as it may end the session.
+		expected := Links{ts.URL + "/page"}
+		if fmt.Sprint(page.Links) != fmt.Sprint(expected) {
+			t.Errorf("%s: parse(): expected links %v, got %v", test.name, expected, page.Links)
+		}
+
+		// The session expires, so the parser logs in again and fetches the page again.
+		site.expire()
+
+		page, err = p.parse(context.TODO(), ts.URL+"/page")
+		if err != nil {
+			t.Errorf("%s: parse(): expected no error returned after the session expired, got %s", test.name, err.Error())
+			t.FailNow()
+		}
+
+		if page.Status != http.StatusOK || page.Addr != CanonicalURL(ts.URL+"/page") {
+			t.Errorf("%s: parse(): expected %s/page to be fetched again after logging in, got %s with status %d", test.name, ts.URL, page.Addr, page.Status)
+		}
+
+		if site.logins != 2 {
+			t.Errorf("%s: parse(): expected to log in twice, logged in %d times", test.name, site.logins)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestLoginFails(t *testing.T) {
+	_, ts := getLoginSite(t)
+	defer ts.Close()
+
+	var tests = []struct {
+		login    *Login
+		expected string
+	}{
+		{&Login{Page: ts.URL + "/login", Form: map[string]string{"username": "admin", "password": "wrong"}}, "redirected back to the login page"},
+		{&Login{URL: ts.URL + "/api/login", Body: `{}`}, "returned status 401"},
+		{&Login{Page: ts.URL + "/about"}, errLoginForm.Error()},
+		{&Login{Body: `{}`}, "a login URL is required"},
+		{&Login{}, "a login page or a login URL is required"},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(ts.URL)
+
+		c := NewCrawler(u, 1)
+		c.SetFetchOptions(FetchOptions{Login: test.login})
+
+		err := c.Login(context.TODO())
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Login(): expected an error containing %q, got %v", test.expected, err)
+		}
+	}
+}
+
+func TestLoginIsCancelled(t *testing.T) {
+	// The login page and endpoint don't respond until the test is over.
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	for _, login := range []*Login{
+		{Page: ts.URL + "/login", Form: map[string]string{"username": "admin"}},
+		{URL: ts.URL + "/api/login", Body: `{}`},
+	} {
+		u, _ := url.Parse(ts.URL)
+
+		c := NewCrawler(u, 1)
+		c.SetFetchOptions(FetchOptions{Login: login, Timeout: time.Minute})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+
+		start := time.Now()
+		err := c.Login(ctx)
+		cancel()
+
+		if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) || time.Since(start) > 10*time.Second {
+			t.Errorf("Login(): expected logging in to stop once the context is done, got %v after %s", err, time.Since(start))
+		}
+	}
+}
+
+func TestReadForm(t *testing.T) {
+	var tests = []struct {
+		page     string
+		expected form
+	}{
+		{
+			`<form action="/a" method="post"><input name="a" value="1"><input type="radio" name="b" value="2" checked></form>`,
+			form{action: "/a", method: http.MethodPost, values: url.Values{"a": {"1"}, "b": {"2"}}},
+		},
+		{
+			`<form action="/search"><input name="q"></form><form><input name="user"><input type="password" name="pass"></form>`,
+			form{method: http.MethodGet, values: url.Values{"user": {""}, "pass": {""}}, password: true},
+		},
+	}
+
+	for _, test := range tests {
+		actual, err := readForm(strings.NewReader(test.page))
+		if err != nil {
+			t.Errorf("readForm(): expected no error returned, got %s", err.Error())
+			t.FailNow()
+		}
+
+		if fmt.Sprint(actual) != fmt.Sprint(test.expected) {
+			t.Errorf("readForm(): expected %v, got %v", test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Markdown renders a report of the given sitemap in Markdown, suitable for pasting into design docs or pull requests.
+// The report contains summary stats, a table of the pages crawled and lists of the broken and redirected links.
+// External pages and links are left out of the report.
+func Markdown(s *Sitemap) (string, error) {
+	var buffer bytes.Buffer
+
+	s = s.Internal()
+	pages := s.Pages()
+	broken := BrokenLinks(s)
+	redirected := getRedirectedLinks(s)
+
+	_, err := buffer.WriteString("# Sitemap report\n\n## Summary\n\n")
+	if err != nil {
+		return "", fmt.Errorf("error generating the markdown output: %s", err.Error())
+	}
+
+	summary := [][2]string{
+		{"Pages crawled", strconv.Itoa(len(pages))},
+		{"Links found", strconv.Itoa(len(s.Edges()))},
+		{"Broken links", strconv.Itoa(len(broken))},
+		{"Redirected links", strconv.Itoa(len(redirected))},
+	}
+
+	for _, status := range getStatusCounts(s) {
+		summary = append(summary, [2]string{"Pages with status " + status[0], status[1]})
+	}
+
+	err = writeMarkdownTable(&buffer, []string{"Metric", "Value"}, pairsToRows(summary))
+	if err != nil {
+		return "", fmt.Errorf("error writing the summary: %s", err.Error())
+	}
+
+	var rows [][]string
+	for _, page := range pages {
+		rows = append(rows, []string{
+			string(page.URL),
+			statusText(page),
+			strconv.Itoa(page.Depth),
+			page.Title,
+			strconv.Itoa(len(s.Outbound(page.URL))),
+		})
+	}
+
+	_, err = buffer.WriteString("\n## Pages\n\n")
+	if err != nil {
+		return "", fmt.Errorf("error generating the markdown output: %s", err.Error())
+	}
+
+	err = writeMarkdownTable(&buffer, []string{"Page", "Status", "Depth", "Title", "Links"}, rows)
+	if err != nil {
+		return "", fmt.Errorf("error writing the page table: %s", err.Error())
+	}
+
+	_, err = buffer.WriteString("\n## Broken links\n\n")
+	if err != nil {
+		return "", fmt.Errorf("error generating the markdown output: %s", err.Error())
+	}
+
+	rows = nil
+	for _, l := range broken {
+		target, _ := s.Node(CanonicalURL(l.Target))
+		rows = append(rows, []string{l.Source, l.Target, statusText(target)})
+	}
+
+	err = writeMarkdownTable(&buffer, []string{"Found on", "Link", "Status"}, rows)
+	if err != nil {
+		return "", fmt.Errorf("error writing the broken links: %s", err.Error())
+	}
+
+	_, err = buffer.WriteString("\n## Redirected links\n\n")
+	if err != nil {
+		return "", fmt.Errorf("error generating the markdown output: %s", err.Error())
+	}
+
+	rows = nil
+	for _, l := range redirected {
+		rows = append(rows, []string{l.Source, l.Target, l.RedirectsTo})
+	}
+
+	err = writeMarkdownTable(&buffer, []string{"Found on", "Link", "Redirects to"}, rows)
+	if err != nil {
+		return "", fmt.Errorf("error writing the redirected links: %s", err.Error())
+	}
+
+	return buffer.String(), nil
+}
+
+// LinkReport describes a single link found on a page which needs attention, e.g. because it's broken.
+// Source is the page the link was found on and Target is the link itself.
+// RedirectsTo is the URL the target redirects to, if any.
+type LinkReport struct {
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	RedirectsTo string `json:"redirectsTo,omitempty"`
+}
+
+// BrokenLinks returns the links pointing to pages which couldn't be fetched or returned an error status, sorted.
+func BrokenLinks(s *Sitemap) []LinkReport {
+	var broken []LinkReport
+
+	for _, edge := range s.Edges() {
+		target, _ := s.Node(edge.To)
+		if target.Error != "" || target.Status >= 400 {
+			broken = append(broken, LinkReport{Source: string(edge.From), Target: string(edge.To)})
+		}
+	}
+
+	return broken
+}
+
+// getRedirectedLinks returns the links pointing to pages which redirected elsewhere when fetched, sorted.
+func getRedirectedLinks(s *Sitemap) []LinkReport {
+	var redirected []LinkReport
+
+	for _, edge := range s.Edges() {
+		target, _ := s.Node(edge.To)
+		if target.RedirectsTo != "" {
+			redirected = append(redirected, LinkReport{Source: string(edge.From), Target: string(edge.To), RedirectsTo: string(target.RedirectsTo)})
+		}
+	}
+
+	return redirected
+}
+
+// getStatusCounts returns the number of pages per status code, sorted by status code.
+// Pages which couldn't be fetched are counted under "error".
+func getStatusCounts(s *Sitemap) [][2]string {
+	counts := make(map[string]int)
+	for _, n := range s.Nodes() {
+		if n.Error != "" {
+			counts["error"]++
+		} else if n.Crawled {
+			counts[strconv.Itoa(n.Status)]++
+		}
+	}
+
+	var statuses []string
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+
+	sort.Strings(statuses)
+
+	var result [][2]string
+	for _, status := range statuses {
+		result = append(result, [2]string{status, strconv.Itoa(counts[status])})
+	}
+
+	return result
+}
+
+// statusText returns the page's status code as text, or the fetch error if the page couldn't be fetched.
+func statusText(n Node) string {
+	if n.Error != "" {
+		return "error: " + n.Error
+	}
+
+	if n.Status == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(n.Status)
+}
+
+func writeMarkdownTable(buffer *bytes.Buffer, header []string, rows [][]string) error {
+	if len(rows) == 0 {
+		_, err := buffer.WriteString("None.\n")
+		return err
+	}
+
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+
+	for _, row := range append([][]string{header, separator}, rows...) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = escapeMarkdownCell(cell)
+		}
+
+		_, err := buffer.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func escapeMarkdownCell(s string) string {
+	s = strings.Replace(s, "|", "\\|", -1)
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+func pairsToRows(pairs [][2]string) [][]string {
+	rows := make([][]string, len(pairs))
+	for i, p := range pairs {
+		rows[i] = []string{p[0], p[1]}
+	}
+
+	return rows
+}
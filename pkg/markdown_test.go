@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdown(t *testing.T) {
+	pages := getTestPages()
+	pages[1].Links = append(pages[1].Links, "https://test.com/old-bar")
+	pages[2].RedirectedFrom = "https://test.com/old-bar"
+
+	s := NewSitemap()
+	for _, p := range pages[:3] {
+		s.AddPage(p)
+	}
+	s.AddNode(Node{URL: CanonicalURL("https://test.com/baz"), Depth: 2, Error: "connection refused"})
+
+	actual, err := Markdown(s)
+	if err != nil {
+		t.Errorf("Markdown(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expectedLines := []string{
+		"# Sitemap report",
+		"| Pages crawled | 3 |",
+		"| Links found | 7 |",
+		"| Broken links | 3 |",
+		"| Redirected links | 1 |",
+		"| Pages with status 200 | 2 |",
+		"| Pages with status 404 | 1 |",
+		"| Pages with status error | 1 |",
+		"| https://test.com/foo | 404 | 1 | Foo & friends | 3 |",
+		"| https://test.com | https://test.com/foo | 404 |",
+		"| https://test.com/bar | https://test.com/foo | 404 |",
+		"| https://test.com/foo | https://test.com/baz | error: connection refused |",
+		"| https://test.com/foo | https://test.com/old-bar | https://test.com/bar |",
+	}
+
+	for _, ll := range expectedLines {
+		if !strings.Contains(actual, ll) {
+			t.Errorf("Markdown(): expected output %s to contain line %s", actual, ll)
+		}
+	}
+}
+
+func TestMarkdownWithNoIssues(t *testing.T) {
+	s := NewSitemap()
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com"), Links: Links{"https://test.com/foo"}, Status: 200})
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com/foo"), Status: 200, Depth: 1})
+
+	actual, err := Markdown(s)
+	if err != nil {
+		t.Errorf("Markdown(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if strings.Count(actual, "None.") != 2 {
+		t.Errorf("Markdown(): expected no broken or redirected links to be listed, got %s", actual)
+	}
+}
+
+func TestEscapeMarkdownCell(t *testing.T) {
+	actual := escapeMarkdownCell("foo | bar\nbaz")
+	expected := "foo \\| bar baz"
+
+	if actual != expected {
+		t.Errorf("escapeMarkdownCell(): expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Mermaid renders the given sitemap as a Mermaid flowchart, which can be embedded in Markdown documents.
+// Large flowcharts quickly become unreadable, so only pages up to maxDepth levels deep are included,
+// and at most maxNodes pages, picking the shallowest ones first. Either limit can be set to 0 for unlimited.
+// External pages are left out of the flowchart.
+func Mermaid(s *Sitemap, maxDepth int, maxNodes int) (string, error) {
+	s = s.Internal()
+
+	var nodes []Node
+	for _, node := range s.Nodes() {
+		if maxDepth == 0 || node.Depth <= maxDepth {
+			nodes = append(nodes, node)
+		}
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Depth < nodes[j].Depth })
+
+	if maxNodes > 0 && len(nodes) > maxNodes {
+		nodes = nodes[:maxNodes]
+	}
+
+	ids := make(map[CanonicalURL]string)
+
+	var buffer bytes.Buffer
+
+	_, err := buffer.WriteString("flowchart LR\n")
+	if err != nil {
+		return "", fmt.Errorf("error generating the mermaid output: %s", err.Error())
+	}
+
+	for i, node := range nodes {
+		ids[node.URL] = fmt.Sprintf("n%d", i)
+
+		_, err := buffer.WriteString(fmt.Sprintf("    %s[\"%s\"]\n", ids[node.URL], escapeMermaidLabel(string(node.URL))))
+		if err != nil {
+			return "", fmt.Errorf("error writing the mermaid nodes: %s", err.Error())
+		}
+	}
+
+	for _, edge := range s.Edges() {
+		from, ok := ids[edge.From]
+		if !ok {
+			continue
+		}
+
+		to, ok := ids[edge.To]
+		if !ok {
+			continue
+		}
+
+		_, err := buffer.WriteString(fmt.Sprintf("    %s --> %s\n", from, to))
+		if err != nil {
+			return "", fmt.Errorf("error writing the mermaid links: %s", err.Error())
+		}
+	}
+
+	return buffer.String(), nil
+}
+
+func escapeMermaidLabel(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
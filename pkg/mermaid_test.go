@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMermaid(t *testing.T) {
+	actual, err := Mermaid(getTestSitemap(), 0, 0)
+	if err != nil {
+		t.Errorf("Mermaid(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expected := `flowchart LR
+    n0["https://test.com"]
+    n1["https://test.com/bar"]
+    n2["https://test.com/foo"]
+    n3["https://test.com/baz"]
+    n0 --> n0
+    n0 --> n1
+    n0 --> n2
+    n1 --> n2
+    n2 --> n1
+    n2 --> n3
+`
+
+	if actual != expected {
+		t.Errorf("Mermaid(): expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestMermaidRespectsLimits(t *testing.T) {
+	s := NewSitemap()
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com"), Links: Links{"https://test.com/foo", "https://test.com/bar"}})
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com/foo"), Links: Links{"https://test.com/foo/baz"}, Depth: 1})
+
+	var limitTests = []struct {
+		maxDepth int
+		maxNodes int
+		expected []string
+	}{
+		{0, 0, []string{"https://test.com", "https://test.com/bar", "https://test.com/foo", "https://test.com/foo/baz"}},
+		{1, 0, []string{"https://test.com", "https://test.com/bar", "https://test.com/foo"}},
+		{0, 2, []string{"https://test.com", "https://test.com/bar"}},
+	}
+
+	for _, tt := range limitTests {
+		actual, err := Mermaid(s, tt.maxDepth, tt.maxNodes)
+		if err != nil {
+			t.Errorf("Mermaid(%d, %d): expected no errors returned, got %s", tt.maxDepth, tt.maxNodes, err.Error())
+			continue
+		}
+
+		if strings.Count(actual, "[\"") != len(tt.expected) {
+			t.Errorf("Mermaid(%d, %d): expected %d nodes, got %s", tt.maxDepth, tt.maxNodes, len(tt.expected), actual)
+		}
+
+		for _, node := range tt.expected {
+			if !strings.Contains(actual, "[\""+node+"\"]") {
+				t.Errorf("Mermaid(%d, %d): expected output %s to contain node %s", tt.maxDepth, tt.maxNodes, actual, node)
+			}
+		}
+	}
+}
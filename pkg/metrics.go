@@ -0,0 +1,231 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FetchLatencyBuckets are the upper bounds (in seconds) of the buckets of the fetch latency histogram.
+var FetchLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects counters and histograms about crawls, and serves them in the Prometheus text format.
+// A single Metrics can be shared by several crawls (e.g. the jobs run by a Server), in which case the values
+// add up across all of them:
+//
+//	crawler_fetches_total{class="2xx"}          pages fetched, by status class (2xx, 3xx, 4xx, 5xx or error)
+//	crawler_downloaded_bytes_total              bytes of response bodies downloaded
+//	crawler_fetch_duration_seconds              histogram of the time taken to fetch and parse a page
+//	crawler_frontier_size                       links found which are waiting to be visited
+//	crawler_fetch_errors_total{type="timeout"}  pages which couldn't be fetched, by error type
+//	crawler_fetch_retries_total                 fetches retried after a transient failure
+//	crawler_connections_total{reused="true"}    connections requests were sent over, by whether they were reused
+type Metrics struct {
+	mutex        sync.Mutex
+	fetches      map[string]int
+	bytes        int64
+	latency      []int
+	latencySum   float64
+	latencyCount int
+	frontier     int
+	errors       map[string]int
+	retries      int
+	connections  map[string]int
+}
+
+// NewMetrics returns an empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		fetches:     make(map[string]int),
+		latency:     make([]int, len(FetchLatencyBuckets)),
+		errors:      make(map[string]int),
+		connections: make(map[string]int),
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buffer bytes.Buffer
+
+	err := m.write(&buffer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buffer.Bytes())
+}
+
+// fetched records a page fetched with the given status, along with the size of its body and the time it took.
+func (m *Metrics) fetched(status int, size int64, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.fetches[fmt.Sprintf("%dxx", status/100)]++
+	m.bytes += size
+	m.observe(d)
+}
+
+// failed records a page which couldn't be fetched.
+func (m *Metrics) failed(err error, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.fetches["error"]++
+	m.errors[errorType(err)]++
+	m.observe(d)
+}
+
+// retried records a fetch which is retried after a transient failure.
+func (m *Metrics) retried() {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	m.retries++
+	m.mutex.Unlock()
+}
+
+// connection records a connection obtained to send a request, and whether it was reused.
+func (m *Metrics) connection(reused bool) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	m.connections[strconv.FormatBool(reused)]++
+	m.mutex.Unlock()
+}
+
+// queued records links waiting to be visited (or visited, if n is negative).
+func (m *Metrics) queued(n int) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	m.frontier += n
+	m.mutex.Unlock()
+}
+
+func (m *Metrics) observe(d time.Duration) {
+	seconds := d.Seconds()
+
+	for i, bound := range FetchLatencyBuckets {
+		if seconds <= bound {
+			m.latency[i]++
+		}
+	}
+
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+func (m *Metrics) write(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var buffer bytes.Buffer
+
+	metric := func(name string, kind string, help string) {
+		fmt.Fprintf(&buffer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("crawler_fetches_total", "counter", "Pages fetched, by status class.")
+	for _, class := range sortedKeys(m.fetches) {
+		fmt.Fprintf(&buffer, "crawler_fetches_total{class=%q} %d\n", class, m.fetches[class])
+	}
+
+	metric("crawler_downloaded_bytes_total", "counter", "Bytes of response bodies downloaded.")
+	fmt.Fprintf(&buffer, "crawler_downloaded_bytes_total %d\n", m.bytes)
+
+	metric("crawler_fetch_duration_seconds", "histogram", "Time taken to fetch and parse a page.")
+	for i, bound := range FetchLatencyBuckets {
+		fmt.Fprintf(&buffer, "crawler_fetch_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), m.latency[i])
+	}
+	fmt.Fprintf(&buffer, "crawler_fetch_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(&buffer, "crawler_fetch_duration_seconds_sum %s\n", strconv.FormatFloat(m.latencySum, 'g', -1, 64))
+	fmt.Fprintf(&buffer, "crawler_fetch_duration_seconds_count %d\n", m.latencyCount)
+
+	metric("crawler_frontier_size", "gauge", "Links found which are waiting to be visited.")
+	fmt.Fprintf(&buffer, "crawler_frontier_size %d\n", m.frontier)
+
+	metric("crawler_fetch_errors_total", "counter", "Pages which couldn't be fetched, by error type.")
+	for _, t := range sortedKeys(m.errors) {
+		fmt.Fprintf(&buffer, "crawler_fetch_errors_total{type=%q} %d\n", t, m.errors[t])
+	}
+
+	metric("crawler_fetch_retries_total", "counter", "Fetches retried after a transient failure.")
+	fmt.Fprintf(&buffer, "crawler_fetch_retries_total %d\n", m.retries)
+
+	metric("crawler_connections_total", "counter", "Connections requests were sent over, by whether they were reused.")
+	for _, reused := range sortedKeys(m.connections) {
+		fmt.Fprintf(&buffer, "crawler_connections_total{reused=%q} %d\n", reused, m.connections[reused])
+	}
+
+	_, err := w.Write(buffer.Bytes())
+
+	return err
+}
+
+// errorType classifies a fetch error, e.g. as a timeout or a DNS error.
+func errorType(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var certErr x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+
+	switch {
+	case errors.Is(err, ErrExternalDomain):
+		return "external_redirect"
+	case errors.Is(err, ErrTooManyRedirects):
+		return "too_many_redirects"
+	case errors.Is(err, ErrSessionExpired):
+		return "session_expired"
+	case errors.Is(err, ErrNotCached):
+		return "not_cached"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection_refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection_reset"
+	case errors.As(err, &certErr), errors.As(err, &hostErr):
+		return "tls"
+	default:
+		return "other"
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/foo">foo</a><a href="/missing">missing</a>`)
+		case "/foo":
+			fmt.Fprint(w, "<p>foo</p>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Metrics: failed to parse test server addr %s as URL", ts.URL)
+	}
+
+	m := NewMetrics()
+
+	c := NewCrawler(tsURL, 0)
+	c.SetMetrics(m)
+	c.Crawl(context.TODO())
+
+	// A page which can't be fetched, as the scheme is missing.
+	c.parsePage(context.TODO(), "/relative", 1)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	expected := []string{
+		"# TYPE crawler_fetches_total counter",
+		`crawler_fetches_total{class="2xx"} 2`,
+		`crawler_fetches_total{class="4xx"} 1`,
+		`crawler_fetches_total{class="error"} 1`,
+		"crawler_downloaded_bytes_total 62",
+		"# TYPE crawler_fetch_duration_seconds histogram",
+		`crawler_fetch_duration_seconds_bucket{le="+Inf"} 4`,
+		"crawler_fetch_duration_seconds_count 4",
+		"crawler_frontier_size 0",
+		`crawler_fetch_errors_total{type="other"} 1`,
+		"crawler_fetch_retries_total 0",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("ServeHTTP(): expected the metrics to contain %s, got:\n%s", line, rec.Body.String())
+		}
+	}
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("ServeHTTP(): expected the Prometheus text format, got %s", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestMetricsHistogramBuckets(t *testing.T) {
+	m := NewMetrics()
+	m.fetched(200, 10, 0)
+	m.fetched(200, 10, 3*time.Second)
+
+	var buffer strings.Builder
+	m.write(&buffer)
+
+	for _, line := range []string{
+		`crawler_fetch_duration_seconds_bucket{le="0.05"} 1`,
+		`crawler_fetch_duration_seconds_bucket{le="2.5"} 1`,
+		`crawler_fetch_duration_seconds_bucket{le="5"} 2`,
+		"crawler_fetch_duration_seconds_sum 3",
+	} {
+		if !strings.Contains(buffer.String(), line+"\n") {
+			t.Errorf("write(): expected the metrics to contain %s, got:\n%s", line, buffer.String())
+		}
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	var tests = []struct {
+		err      error
+		expected string
+	}{
+		{&url.Error{Op: "Get", URL: "https://test.com", Err: ErrExternalDomain}, "external_redirect"},
+		{&url.Error{Op: "Get", URL: "https://test.com", Err: ErrTooManyRedirects}, "too_many_redirects"},
+		{&url.Error{Op: "Get", URL: "https://test.com", Err: ErrSessionExpired}, "session_expired"},
+		{&url.Error{Op: "Get", URL: "https://test.com", Err: ErrNotCached}, "not_cached"},
+		{&url.Error{Op: "Get", URL: "https://test.com", Err: &net.DNSError{Err: "no such host", Name: "test.com"}}, "dns"},
+		{&url.Error{Op: "Get", URL: "https://test.com", Err: context.DeadlineExceeded}, "timeout"},
+		{&url.Error{Op: "Get", URL: "https://test.com", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, "connection_refused"},
+		{&url.Error{Op: "Get", URL: "https://test.com", Err: syscall.ECONNRESET}, "connection_reset"},
+		{errors.New("unsupported protocol scheme"), "other"},
+	}
+
+	for _, test := range tests {
+		actual := errorType(test.err)
+		if actual != test.expected {
+			t.Errorf("errorType(%v): expected %s, got %s", test.err, test.expected, actual)
+		}
+	}
+}
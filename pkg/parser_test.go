@@ -1,13 +1,21 @@
 package crawler
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var parserTests = []struct {
@@ -52,7 +60,7 @@ func TestParse(t *testing.T) {
 		}))
 		defer ts.Close()
 
-		page, err := p.parse(ts.URL)
+		page, err := p.parse(context.TODO(), ts.URL)
 
 		if err != nil {
 			t.Errorf("parse() returned an error: %s", err.Error())
@@ -87,7 +95,7 @@ func TestParse(t *testing.T) {
 
 func TestParseReturnsErrorIfPageInaccessible(t *testing.T) {
 	p := NewParser("", "")
-	_, err := p.parse("")
+	_, err := p.parse(context.TODO(), "")
 
 	if err == nil {
 		t.Error("parse(): expected an an error to be returned, got none")
@@ -110,7 +118,7 @@ func TestParseReturnsErrorIfPageReturnsMoreThan10Redirects(t *testing.T) {
 
 	p := NewParser(tsURL.Scheme, tsURL.Host)
 
-	_, err = p.parse(ts.URL)
+	_, err = p.parse(context.TODO(), ts.URL)
 
 	if err == nil {
 		t.Errorf("parse(endless redirect): expected to get an error, got nil")
@@ -125,6 +133,26 @@ func TestParseReturnsErrorIfPageReturnsMoreThan10Redirects(t *testing.T) {
 	}
 }
 
+func TestParseRespectsFetchTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("couldn't parse the test server URL %s: %s", ts.URL, err.Error())
+	}
+
+	p := NewParser(tsURL.Scheme, tsURL.Host)
+	p.SetFetchOptions(FetchOptions{Timeout: 20 * time.Millisecond})
+
+	_, err = p.parse(context.TODO(), ts.URL)
+	if err == nil {
+		t.Error("parse(slow page): expected to get a timeout error, got nil")
+	}
+}
+
 func TestParseReturnsErrorIfPageRedirectsToExternalDomain(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "https://google.com/foo", http.StatusTemporaryRedirect)
@@ -133,7 +161,7 @@ func TestParseReturnsErrorIfPageRedirectsToExternalDomain(t *testing.T) {
 
 	p := NewParser("https", "notgoogle.com")
 
-	_, err := p.parse(ts.URL)
+	_, err := p.parse(context.TODO(), ts.URL)
 
 	if err == nil {
 		t.Errorf("parse(external): expected to get an error, got nil")
@@ -169,7 +197,7 @@ func TestParseFollowsRedirectsWithinDomain(t *testing.T) {
 
 	p := NewParser(tsURL.Scheme, tsURL.Host)
 
-	page, err := p.parse(ts.URL)
+	page, err := p.parse(context.TODO(), ts.URL)
 	if err != nil {
 		t.Errorf("parse(redirect) returned an error: %s", err.Error())
 		t.FailNow()
@@ -184,6 +212,10 @@ func TestParseFollowsRedirectsWithinDomain(t *testing.T) {
 		t.Errorf("parse(redirect) page.Addr: expected %s, actual %s", expected.Addr, page.Addr)
 	}
 
+	if page.RedirectedFrom != ts.URL {
+		t.Errorf("parse(redirect) page.RedirectedFrom: expected %s, actual %s", ts.URL, page.RedirectedFrom)
+	}
+
 	if len(page.Links) != len(expected.Links) {
 		t.Errorf("parse(redirect) expected page.Links to contain %d links, got %d", len(expected.Links), len(page.Links))
 		t.FailNow()
@@ -195,6 +227,93 @@ func TestParseFollowsRedirectsWithinDomain(t *testing.T) {
 	}
 }
 
+func TestParseRecordsPageDetails(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, `<html><head><title>
+			Not   found</title></head>
+			<body><a rel="nofollow" href="/foo">Go to <b>foo</b></a> <a href="/foo">Foo again</a> <a href="/bar"></a></body></html>`)
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("couldn't parse the test server URL %s: %s", ts.URL, err.Error())
+	}
+
+	p := NewParser(tsURL.Scheme, tsURL.Host)
+
+	page, err := p.parse(context.TODO(), ts.URL)
+	if err != nil {
+		t.Errorf("parse() returned an error: %s", err.Error())
+		t.FailNow()
+	}
+
+	if page.Status != http.StatusNotFound {
+		t.Errorf("parse() page.Status: expected %d, actual %d", http.StatusNotFound, page.Status)
+	}
+
+	if page.Title != "Not found" {
+		t.Errorf("parse() page.Title: expected %q, actual %q", "Not found", page.Title)
+	}
+
+	expected := map[string]Anchor{
+		ts.URL + "/foo": {Rel: "nofollow", Text: "Go to foo"},
+		ts.URL + "/bar": {},
+	}
+
+	if len(page.Anchors) != len(expected) {
+		t.Errorf("parse() page.Anchors: expected %v, actual %v", expected, page.Anchors)
+	}
+
+	for link, a := range expected {
+		if page.Anchors[link] != a {
+			t.Errorf("parse() page.Anchors[%s]: expected %v, actual %v", link, a, page.Anchors[link])
+		}
+	}
+}
+
+func TestParseHashesVisibleText(t *testing.T) {
+	var tests = []struct {
+		first  string
+		second string
+		same   bool
+	}{
+		{`<p>Hello <b>world</b></p>`, "<div>\n\tHello   world\n</div>", true},
+		{`<a href="https://staging.test.com">Home</a>`, `<a href="https://test.com">Home</a>`, true},
+		{`<p>Hello</p><script>var build = 1;</script><style>p {}</style>`, `<p>Hello</p><script>var build = 2;</script>`, true},
+		{`<p>Hello world</p>`, `<p>Hello, world</p>`, false},
+	}
+
+	for _, test := range tests {
+		var hashes []string
+
+		for _, body := range []string{test.first, test.second} {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, body)
+			}))
+
+			tsURL, _ := url.Parse(ts.URL)
+
+			p := NewParser(tsURL.Scheme, tsURL.Host)
+
+			page, err := p.parse(context.TODO(), ts.URL)
+			ts.Close()
+
+			if err != nil {
+				t.Errorf("parse() returned an error: %s", err.Error())
+				t.FailNow()
+			}
+
+			hashes = append(hashes, page.Hash)
+		}
+
+		if hashes[0] == "" || (hashes[0] == hashes[1]) != test.same {
+			t.Errorf("parse() page.Hash: expected the hashes of %q and %q to be the same: %v, got %v", test.first, test.second, test.same, hashes)
+		}
+	}
+}
+
 var normaliseTests = []struct {
 	rawURL      string
 	expectedURL string
@@ -217,6 +336,394 @@ var normaliseTests = []struct {
 	{"https://google.com/foo?bar=baz", "https://google.com/foo"},
 }
 
+func TestParseSendsIdentityHeaders(t *testing.T) {
+	var tests = []struct {
+		opts     FetchOptions
+		expected http.Header
+	}{
+		{FetchOptions{}, http.Header{"User-Agent": {DefaultUserAgent}}},
+		{
+			FetchOptions{UserAgent: "docs-bot/2.0", AcceptLanguage: "en-GB,en;q=0.8", From: "web@example.com"},
+			http.Header{"User-Agent": {"docs-bot/2.0"}, "Accept-Language": {"en-GB,en;q=0.8"}, "From": {"web@example.com"}},
+		},
+	}
+
+	for _, test := range tests {
+		var actual http.Header
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actual = r.Header
+		}))
+
+		u, _ := url.Parse(ts.URL)
+
+		// Headers set for the host in the credentials take precedence.
+		test.opts.Credentials = map[string]Credentials{u.Host: {Headers: map[string]string{"Accept-Language": "fr"}}}
+		test.expected.Set("Accept-Language", "fr")
+
+		p := NewParser(u.Scheme, u.Host)
+		p.SetFetchOptions(test.opts)
+
+		_, err := p.parse(context.TODO(), ts.URL)
+		if err != nil {
+			t.Errorf("parse(): expected no error returned, got %s", err.Error())
+		}
+
+		for name := range test.expected {
+			if actual.Get(name) != test.expected.Get(name) {
+				t.Errorf("parse(): expected %s header %q, got %q", name, test.expected.Get(name), actual.Get(name))
+			}
+		}
+
+		if _, ok := test.expected["From"]; !ok && actual.Get("From") != "" {
+			t.Errorf("parse(): expected no From header, got %q", actual.Get("From"))
+		}
+
+		ts.Close()
+	}
+}
+
+func TestParseRetriesTransientFailures(t *testing.T) {
+	var tests = []struct {
+		failures []int
+		retries  int
+		status   int
+		attempts int
+	}{
+		{[]int{503, 429}, 2, http.StatusOK, 3},
+		{[]int{503, 503}, 1, http.StatusServiceUnavailable, 2},
+		{[]int{500}, 0, http.StatusInternalServerError, 1},
+		{[]int{404}, 2, http.StatusNotFound, 1},
+		{[]int{0}, 1, http.StatusOK, 2},
+	}
+
+	for _, test := range tests {
+		var requests int32
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := int(atomic.AddInt32(&requests, 1))
+			if n > len(test.failures) {
+				return
+			}
+
+			// A status of 0 stands for a timeout.
+			if test.failures[n-1] == 0 {
+				time.Sleep(100 * time.Millisecond)
+				return
+			}
+
+			w.WriteHeader(test.failures[n-1])
+		}))
+
+		u, _ := url.Parse(ts.URL)
+
+		p := NewParser(u.Scheme, u.Host)
+		p.SetFetchOptions(FetchOptions{Timeout: 50 * time.Millisecond, Retries: test.retries, RetryBackoff: time.Millisecond})
+
+		page, err := p.parse(context.TODO(), ts.URL)
+		if err != nil {
+			t.Errorf("parse(): expected no error returned, got %s", err.Error())
+		}
+
+		if page.Status != test.status || page.Attempts != test.attempts {
+			t.Errorf("parse(): expected status %d after %d attempt(s) with failures %v and %d retries, got %d after %d",
+				test.status, test.attempts, test.failures, test.retries, page.Status, page.Attempts)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestParseRetriesTruncatedBodies(t *testing.T) {
+	body := `<title>Page</title><a href="/foo">foo</a>` + strings.Repeat("<p>text</p>", 200)
+
+	// The connection is dropped either within the start of the body used to detect the charset, or near its end.
+	for _, sent := range []int{10, len(body) - 10} {
+		var requests int64
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt64(&requests, 1) == 1 {
+				w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+				w.Write([]byte(body[:sent]))
+				return
+			}
+
+			fmt.Fprint(w, body)
+		}))
+
+		u, _ := url.Parse(ts.URL)
+
+		p := NewParser(u.Scheme, u.Host)
+
+		page, err := p.parse(context.TODO(), ts.URL)
+		if err == nil || !errors.Is(err, io.ErrUnexpectedEOF) || page.Attempts != 1 {
+			t.Errorf("parse(): expected the page truncated after %d bytes to fail with %s, got %v and %+v", sent, io.ErrUnexpectedEOF, err, page)
+		}
+
+		p.SetFetchOptions(FetchOptions{Retries: 1, RetryBackoff: time.Millisecond})
+		atomic.StoreInt64(&requests, 0)
+
+		page, err = p.parse(context.TODO(), ts.URL)
+		if err != nil || page.Attempts != 2 || page.Title != "Page" || len(page.Links) != 1 {
+			t.Errorf("parse(): expected the page truncated after %d bytes to be retried, got %v and %+v", sent, err, page)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestParseRecordsAttemptsOfFailedPages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+
+	c := NewCrawler(u, 1)
+	c.SetFetchOptions(FetchOptions{Timeout: 20 * time.Millisecond, Retries: 2, RetryBackoff: time.Millisecond})
+
+	s := c.Crawl(context.TODO())
+
+	node, ok := s.Node(CanonicalURL(ts.URL))
+	if !ok || node.Error == "" || node.Attempts != 3 {
+		t.Errorf("Crawl(): expected the page to fail after 3 attempts, got %+v", node)
+	}
+}
+
+func TestParseOnlyParsesHTML(t *testing.T) {
+	body := `<title>Doc</title><a href="/foo">foo</a>`
+
+	var tests = []struct {
+		contentType string
+		length      bool
+		expected    Page
+	}{
+		{"text/html; charset=utf-8", true, Page{Status: 200, ContentType: "text/html", Size: 40, Title: "Doc", Links: Links{"/foo"}}},
+		{"application/xhtml+xml", true, Page{Status: 200, ContentType: "application/xhtml+xml", Size: 40, Title: "Doc", Links: Links{"/foo"}}},
+		{"", true, Page{Status: 200, ContentType: "text/html", Size: 40, Title: "Doc", Links: Links{"/foo"}}},
+		{"application/pdf", true, Page{Status: 200, ContentType: "application/pdf", Size: 40}},
+		{"image/png", false, Page{Status: 200, ContentType: "image/png", Size: 40}},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Setting an empty content type stops the server from sniffing it, so that the parser does.
+			w.Header()["Content-Type"] = []string{test.contentType}
+			if test.contentType == "" {
+				w.Header()["Content-Type"] = nil
+			}
+
+			if test.length {
+				w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			} else {
+				w.(http.Flusher).Flush()
+			}
+
+			fmt.Fprint(w, body)
+		}))
+
+		u, _ := url.Parse(ts.URL)
+
+		p := NewParser(u.Scheme, u.Host)
+
+		page, err := p.parse(context.TODO(), ts.URL)
+		if err != nil {
+			t.Errorf("parse(): expected no error returned, got %s", err.Error())
+		}
+
+		var links Links
+		for _, l := range test.expected.Links {
+			links = append(links, ts.URL+l)
+		}
+
+		if page.Status != test.expected.Status || page.ContentType != test.expected.ContentType || page.Size != test.expected.Size ||
+			page.Title != test.expected.Title || fmt.Sprint(page.Links) != fmt.Sprint(links) {
+			t.Errorf("parse(): expected %+v for content type %q, got %+v", test.expected, test.contentType, page)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestParseKeepsConnectionsAfterSmallResources(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/foo.pdf">foo</a><a href="/bar.pdf">bar</a>`)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", "1000")
+		w.Write(make([]byte, 1000))
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+
+	c := NewCrawler(u, 0)
+	c.Crawl(context.TODO())
+
+	// Small resources are read even though they aren't parsed, so that the connection can be reused for the next page.
+	if actual := c.Stats().Connections; actual != (ConnStats{Opened: 1, Reused: 2}) {
+		t.Errorf("Crawl(): expected a single connection reused for every page, got %+v", actual)
+	}
+}
+
+func TestParseTranscodesToUTF8(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		body        []byte
+		title       string
+		link        string
+	}{
+		// 日本 in Shift_JIS, declared in the Content-Type header.
+		{"shift_jis", "text/html; charset=Shift_JIS", []byte("<title>\x93\xfa\x96\x7b</title><a href=\"/\x93\xfa\x96\x7b\">x</a>"), "日本", "/日本"},
+		// café in ISO-8859-1, declared in a <meta charset> tag.
+		{"iso-8859-1", "text/html", []byte("<meta charset=\"iso-8859-1\"><title>caf\xe9</title><a href=\"/caf\xe9\">x</a>"), "café", "/café"},
+		// Привет in Windows-1251, declared in a http-equiv <meta> tag.
+		{"windows-1251", "text/html", []byte("<meta http-equiv=\"Content-Type\" content=\"text/html; charset=windows-1251\">" +
+			"<title>\xcf\xf0\xe8\xe2\xe5\xf2</title><a href=\"/\xcf\xf0\xe8\xe2\xe5\xf2\">x</a>"), "Привет", "/Привет"},
+		// é in UTF-16 (little endian), detected from the BOM.
+		{"utf-16", "text/html", []byte("\xff\xfe<\x00t\x00i\x00t\x00l\x00e\x00>\x00\xe9\x00<\x00/\x00t\x00i\x00t\x00l\x00e\x00>\x00"), "é", ""},
+		{"utf-8", "text/html", []byte("<title>日本</title><a href=\"/日本\">x</a>"), "日本", "/日本"},
+	}
+
+	for _, test := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			w.Write(test.body)
+		}))
+
+		u, _ := url.Parse(ts.URL)
+
+		p := NewParser(u.Scheme, u.Host)
+
+		page, err := p.parse(context.TODO(), ts.URL)
+		if err != nil {
+			t.Errorf("%s: parse(): expected no error returned, got %s", test.name, err.Error())
+		}
+
+		if page.Title != test.title {
+			t.Errorf("%s: parse(): expected title %q, got %q", test.name, test.title, page.Title)
+		}
+
+		if test.link != "" {
+			link, _ := url.Parse(ts.URL + test.link)
+			if len(page.Links) != 1 || page.Links[0] != link.String() {
+				t.Errorf("%s: parse(): expected link %s, got %v", test.name, link, page.Links)
+			}
+		}
+
+		ts.Close()
+	}
+}
+
+func TestParseReadsEmptyPages(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	u, _ := url.Parse(ts.URL)
+
+	p := NewParser(u.Scheme, u.Host)
+
+	page, err := p.parse(context.TODO(), ts.URL)
+	if err != nil || page.Status != http.StatusServiceUnavailable || page.Size != 0 {
+		t.Errorf("parse(): expected an empty page with status 503, got %+v and %v", page, err)
+	}
+
+	if logs.Len() != 0 {
+		t.Errorf("parse(): expected nothing logged for an empty page, got %s", logs.String())
+	}
+}
+
+func TestParseEnforcesMaxBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="/foo">foo</a>`+strings.Repeat(" ", 100)+`<a href="/bar">bar</a>`)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+
+	p := NewParser(u.Scheme, u.Host)
+	p.SetFetchOptions(FetchOptions{MaxBodySize: 50})
+
+	page, err := p.parse(context.TODO(), ts.URL)
+	if err != nil {
+		t.Errorf("parse(): expected no error returned, got %s", err.Error())
+	}
+
+	if !page.Truncated || page.Size != 50 || fmt.Sprint(page.Links) != fmt.Sprint(Links{ts.URL + "/foo"}) {
+		t.Errorf("parse(): expected only the first 50 bytes to be parsed, got %+v", page)
+	}
+
+	p.SetFetchOptions(FetchOptions{MaxBodySize: 144})
+
+	page, _ = p.parse(context.TODO(), ts.URL)
+	if page.Truncated || len(page.Links) != 2 {
+		t.Errorf("parse(): expected a page of exactly the max body size to be parsed entirely, got %+v", page)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Parser{opts: FetchOptions{RetryBackoff: 100 * time.Millisecond, MaxRetryBackoff: time.Second}}
+
+	var tests = []struct {
+		attempt    int
+		retryAfter time.Duration
+		min        time.Duration
+		max        time.Duration
+	}{
+		{1, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{3, 0, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 0, 500 * time.Millisecond, time.Second},
+		{1, 300 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond},
+		{1, time.Minute, time.Second, time.Second},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 10; i++ {
+			actual := p.backoff(test.attempt, test.retryAfter)
+			if actual < test.min || actual > test.max {
+				t.Errorf("backoff(%d, %s): expected a delay between %s and %s, got %s", test.attempt, test.retryAfter, test.min, test.max, actual)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var tests = []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{"soon", 0, 0},
+	}
+
+	for _, test := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if test.header != "" {
+			resp.Header.Set("Retry-After", test.header)
+		}
+
+		actual := retryAfter(resp)
+		if actual < test.min || actual > test.max {
+			t.Errorf("retryAfter(%q): expected a delay between %s and %s, got %s", test.header, test.min, test.max, actual)
+		}
+	}
+}
+
 func TestNormalise(t *testing.T) {
 
 	p := NewParser("https", "google.com")
@@ -0,0 +1,708 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWorkers is the default number of crawl jobs a Server runs at the same time.
+	DefaultWorkers = 2
+
+	// MaxQueuedJobs is the max number of jobs waiting for a worker. Jobs submitted when the queue is full are rejected.
+	MaxQueuedJobs = 100
+
+	// MaxJobRequestSize is the max size in bytes of the body of a request submitting a job.
+	MaxJobRequestSize = 64 << 10
+)
+
+var (
+	// ErrQueueFull is returned when a job is submitted to a Server whose queue is full.
+	ErrQueueFull = errors.New("too many queued jobs")
+
+	// ErrUnknownJob is returned by a Server when asked about a job it doesn't hold.
+	ErrUnknownJob = errors.New("unknown job")
+)
+
+// JobStatus is the state of a crawl job run by a Server.
+type JobStatus string
+
+const (
+	// JobQueued jobs are waiting for a worker.
+	JobQueued JobStatus = "queued"
+
+	// JobRunning jobs are being crawled.
+	JobRunning JobStatus = "running"
+
+	// JobDone jobs crawled the whole site, up to the max depth.
+	JobDone JobStatus = "done"
+
+	// JobPartial jobs were stopped by their timeout, so their results only cover part of the site.
+	JobPartial JobStatus = "partial"
+
+	// JobCancelled jobs were cancelled before they finished. The pages crawled until then are kept.
+	JobCancelled JobStatus = "cancelled"
+
+	// JobFailed jobs couldn't be run, e.g. because the crawl couldn't be saved.
+	JobFailed JobStatus = "failed"
+)
+
+// JobRequest describes the crawl a job should run. Timeouts are durations such as "1m" or "500ms".
+// An empty timeout means no timeout, and an empty fetch timeout means the default FetchTimeout.
+type JobRequest struct {
+	URL          string `json:"url"`
+	Depth        int    `json:"depth"`
+	Timeout      string `json:"timeout,omitempty"`
+	FetchTimeout string `json:"fetchTimeout,omitempty"`
+}
+
+// Job is a crawl job run by a Server. Pages is the number of pages crawled so far (including pages which
+// couldn't be fetched), and RunID is the run in the server's store the pages are saved to.
+type Job struct {
+	ID       string     `json:"id"`
+	Request  JobRequest `json:"request"`
+	Status   JobStatus  `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	RunID    string     `json:"runId,omitempty"`
+	Pages    int        `json:"pages"`
+	Created  time.Time  `json:"created"`
+	Started  time.Time  `json:"started"`
+	Finished time.Time  `json:"finished"`
+}
+
+// Server runs crawl jobs on a bounded pool of workers, and exposes them through a REST API:
+//
+//	POST /jobs                  submits a job described by a JobRequest, returning the Job
+//	GET  /jobs                  lists all the jobs, oldest first
+//	GET  /jobs/{id}             returns a job, including its progress
+//	POST /jobs/{id}/cancel      cancels a queued or running job
+//	GET  /jobs/{id}/results     downloads the results of a job (see ResultFormats for the format param)
+//	GET  /metrics               serves the metrics of all the jobs in the Prometheus format, if enabled with SetMetrics
+//
+// The state of every job is saved in the server's directory, and the crawled pages are saved in a FileStore
+// in its runs sub-directory. Jobs which were queued or running when the server stopped are run again
+// from scratch when a new Server is created for the same directory.
+type Server struct {
+	dir     string
+	store   *FileStore
+	queue   chan string
+	mutex   sync.Mutex
+	jobs    map[string]*Job
+	cancels map[string]context.CancelFunc
+	closing bool
+	wg      sync.WaitGroup
+	metrics *Metrics
+	seq     int
+}
+
+// ResultFormats maps the formats job results can be downloaded in to their content types.
+// The format is given with the format query param (defaults to json, the same layout as SaveSnapshot).
+// The csv format returns the node list, or the edge list with table=edges. The tree format accepts annotate=true,
+// and the mermaid format accepts mermaid-depth and mermaid-nodes. The svg format requires dot to be installed.
+var ResultFormats = map[string]string{
+	"json":     "application/json",
+	"text":     "text/plain; charset=utf-8",
+	"tree":     "text/plain; charset=utf-8",
+	"stats":    "text/plain; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+	"mermaid":  "text/plain; charset=utf-8",
+	"html":     "text/html; charset=utf-8",
+	"svg":      "image/svg+xml",
+	"dot":      "text/vnd.graphviz",
+	"graphml":  "application/xml",
+	"gexf":     "application/xml",
+	"csv":      "text/csv; charset=utf-8",
+}
+
+// NewServer returns a Server keeping its state in the given directory, which is created if it doesn't exist,
+// and starts the given number of workers. Unfinished jobs found in the directory are queued again.
+func NewServer(dir string, workers int) (*Server, error) {
+	err := os.MkdirAll(filepath.Join(dir, "jobs"), 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the jobs directory: %s", err.Error())
+	}
+
+	store, err := NewFileStore(filepath.Join(dir, "runs"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		dir:     dir,
+		store:   store,
+		jobs:    make(map[string]*Job),
+		cancels: make(map[string]context.CancelFunc),
+	}
+
+	pending, err := s.loadJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	size := MaxQueuedJobs
+	if len(pending) > size {
+		size = len(pending)
+	}
+
+	s.queue = make(chan string, size)
+	for _, id := range pending {
+		s.queue <- id
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	return s, nil
+}
+
+// SetMetrics makes the jobs started from now on record their fetches in the given metrics, and serves them on /metrics.
+func (s *Server) SetMetrics(m *Metrics) {
+	s.mutex.Lock()
+	s.metrics = m
+	s.mutex.Unlock()
+}
+
+// invalidRequestError is returned by Submit for job requests which aren't valid.
+type invalidRequestError struct {
+	error
+}
+
+// Submit validates the given request and queues a new job for it.
+func (s *Server) Submit(req JobRequest) (Job, error) {
+	_, _, _, err := req.parse()
+	if err != nil {
+		return Job{}, invalidRequestError{err}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closing {
+		return Job{}, errors.New("the server is shutting down")
+	}
+
+	// The sequence number keeps the IDs of jobs submitted at the same time (as far as the clock can tell) apart.
+	s.seq++
+	now := time.Now().UTC()
+	job := &Job{ID: fmt.Sprintf("%s-%06d", now.Format("20060102T150405.000000000Z"), s.seq), Request: req, Status: JobQueued, Created: now}
+
+	select {
+	case s.queue <- job.ID:
+		s.jobs[job.ID] = job
+	default:
+		return Job{}, ErrQueueFull
+	}
+
+	return *job, s.saveJob(job)
+}
+
+// Job returns the job with the given ID.
+func (s *Server) Job(id string) (Job, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return *job, true
+}
+
+// Jobs returns all the jobs, oldest first.
+func (s *Server) Jobs() []Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+
+	return jobs
+}
+
+// Cancel cancels the given job if it's queued or running. Pages crawled before a job is cancelled are kept.
+func (s *Server) Cancel(id string) (Job, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrUnknownJob
+	}
+
+	switch job.Status {
+	case JobQueued:
+		job.Status = JobCancelled
+		job.Finished = time.Now().UTC()
+	case JobRunning:
+		// The worker running the job records when it finished, once the crawl stops.
+		job.Status = JobCancelled
+		s.cancels[id]()
+	default:
+		return *job, fmt.Errorf("job %s has already finished", id)
+	}
+
+	return *job, s.saveJob(job)
+}
+
+// Results returns the pages crawled by the given job so far.
+func (s *Server) Results(id string) (Snapshot, error) {
+	job, ok := s.Job(id)
+	if !ok {
+		return Snapshot{}, ErrUnknownJob
+	}
+
+	if job.RunID == "" {
+		return Snapshot{}, fmt.Errorf("job %s hasn't started yet", id)
+	}
+
+	return s.store.Snapshot(job.RunID)
+}
+
+// Close stops the workers, interrupting any running jobs, and waits for them to finish.
+// Interrupted jobs are left queued, so that they're run again when the server is restarted.
+// Closing a Server which is already closed has no effect.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.closing = true
+	for _, cancel := range s.cancels {
+		cancel()
+	}
+	close(s.queue)
+	s.mutex.Unlock()
+
+	s.wg.Wait()
+
+	return s.store.Close()
+}
+
+// ServeHTTP implements the REST API described on Server.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/metrics" {
+		s.mutex.Lock()
+		m := s.metrics
+		s.mutex.Unlock()
+
+		if m != nil {
+			m.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "jobs" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.Jobs())
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.handleSubmit(w, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		job, ok := s.Job(parts[1])
+		if !ok {
+			writeError(w, http.StatusNotFound, ErrUnknownJob)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case len(parts) == 3 && parts[2] == "cancel" && r.Method == http.MethodPost:
+		job, err := s.Cancel(parts[1])
+		if err == ErrUnknownJob {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case len(parts) == 3 && parts[2] == "results" && r.Method == http.MethodGet:
+		s.handleResults(w, r, parts[1])
+	case len(parts) <= 2 || parts[2] == "cancel" || parts[2] == "results":
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed on %s", r.Method, r.URL.Path))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+	}
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxJobRequestSize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&req)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("the job request is larger than %d bytes", tooLarge.Limit))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error decoding the job request: %s", err.Error()))
+		return
+	}
+
+	job, err := s.Submit(req)
+	if _, ok := err.(invalidRequestError); ok {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err == ErrQueueFull {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusCreated, job)
+}
+
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request, id string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	contentType, ok := ResultFormats[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported format %q", format))
+		return
+	}
+
+	snap, err := s.Results(id)
+	if err == ErrUnknownJob {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	var buffer bytes.Buffer
+
+	err = writeResults(&buffer, snap, format, r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buffer.Bytes())
+}
+
+// work runs the queued jobs until the queue is closed.
+func (s *Server) work() {
+	defer s.wg.Done()
+
+	for id := range s.queue {
+		s.run(id)
+	}
+}
+
+// run crawls the given job, unless it was cancelled while queued or the server is shutting down.
+func (s *Server) run(id string) {
+	s.mutex.Lock()
+
+	job := s.jobs[id]
+	if job.Status != JobQueued || s.closing {
+		s.mutex.Unlock()
+		return
+	}
+
+	u, timeout, fetchTimeout, _ := job.Request.parse()
+	c := NewCrawler(u, job.Request.Depth)
+	c.SetFetchOptions(FetchOptions{Timeout: fetchTimeout})
+	c.SetMetrics(s.metrics)
+
+	run, err := s.store.CreateRun(u.String(), map[string]string{"job": id})
+	if err != nil {
+		job.Status = JobFailed
+		job.Error = err.Error()
+		job.Finished = time.Now().UTC()
+		s.saveJob(job)
+		s.mutex.Unlock()
+		return
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	s.cancels[id] = cancel
+
+	job.Status = JobRunning
+	job.RunID = run.ID
+	job.Pages = 0
+	job.Started = time.Now().UTC()
+	s.saveJob(job)
+
+	s.mutex.Unlock()
+
+	c.SetStore(jobStore{Store: s.store, saved: func() {
+		s.mutex.Lock()
+		job.Pages++
+		s.mutex.Unlock()
+	}}, run.ID)
+
+	c.Crawl(ctx)
+
+	err = s.store.FinishRun(run.ID)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.cancels, id)
+	cancel()
+
+	switch {
+	case job.Status == JobCancelled:
+	case s.closing:
+		job.Status = JobQueued
+		s.saveJob(job)
+		return
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	case ctx.Err() == context.DeadlineExceeded:
+		job.Status = JobPartial
+	default:
+		job.Status = JobDone
+	}
+
+	job.Finished = time.Now().UTC()
+	s.saveJob(job)
+}
+
+// loadJobs loads the jobs saved in the server's directory, returning the IDs of the unfinished ones, oldest first.
+func (s *Server) loadJobs() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "jobs", "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing the jobs: %s", err.Error())
+	}
+
+	var pending []string
+
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading job %s: %s", file, err.Error())
+		}
+
+		var job Job
+		err = json.Unmarshal(b, &job)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding job %s: %s", file, err.Error())
+		}
+
+		if job.Status == JobQueued || job.Status == JobRunning {
+			job.Status = JobQueued
+			pending = append(pending, job.ID)
+		}
+
+		s.jobs[job.ID] = &job
+	}
+
+	sort.Strings(pending)
+
+	return pending, nil
+}
+
+// saveJob writes the given job to the server's directory. The file is replaced atomically,
+// so that a job is never left half-written if the process dies.
+func (s *Server) saveJob(job *Job) error {
+	b, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding job %s: %s", job.ID, err.Error())
+	}
+
+	file := filepath.Join(s.dir, "jobs", job.ID+".json")
+
+	err = ioutil.WriteFile(file+".tmp", b, 0644)
+	if err == nil {
+		err = os.Rename(file+".tmp", file)
+	}
+	if err != nil {
+		return fmt.Errorf("error saving job %s: %s", job.ID, err.Error())
+	}
+
+	return nil
+}
+
+// parse validates the request, returning the starting URL and the timeouts.
+func (req JobRequest) parse() (*url.URL, time.Duration, time.Duration, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, 0, 0, errors.New("invalid URL: a full, non-relative URL including the protocol must be specified (e.g. https://google.com)")
+	}
+
+	if req.Depth < 0 {
+		return nil, 0, 0, errors.New("depth cannot be negative")
+	}
+
+	var timeout time.Duration
+	if req.Timeout != "" {
+		timeout, err = time.ParseDuration(req.Timeout)
+		if err != nil || timeout < 0 {
+			return nil, 0, 0, fmt.Errorf("invalid timeout %q", req.Timeout)
+		}
+	}
+
+	fetchTimeout := FetchTimeout
+	if req.FetchTimeout != "" {
+		fetchTimeout, err = time.ParseDuration(req.FetchTimeout)
+		if err != nil || fetchTimeout <= 0 {
+			return nil, 0, 0, fmt.Errorf("invalid fetch timeout %q", req.FetchTimeout)
+		}
+	}
+
+	return u, timeout, fetchTimeout, nil
+}
+
+// jobStore saves pages to the underlying store, calling saved after every page so that the job's progress is tracked.
+type jobStore struct {
+	Store
+	saved func()
+}
+
+func (s jobStore) SavePage(runID string, p Page) error {
+	err := s.Store.SavePage(runID, p)
+	s.saved()
+
+	return err
+}
+
+// writeResults renders the given crawl results in the given format (see ResultFormats).
+func writeResults(w io.Writer, snap Snapshot, format string, query url.Values) error {
+	s := snap.Sitemap
+
+	var text string
+	var err error
+
+	switch format {
+	case "json":
+		return writeSnapshot(w, snap)
+	case "html":
+		return writeHTML(w, s)
+	case "dot":
+		return writeDot(w, s)
+	case "svg":
+		return writeSvg(w, s)
+	case "graphml":
+		return writeGraphML(w, s)
+	case "gexf":
+		return writeGEXF(w, s)
+	case "csv":
+		if query.Get("table") == "edges" {
+			return writeEdgesCSV(w, s)
+		}
+		return writeNodesCSV(w, s)
+	case "tree":
+		text, err = Tree(s, query.Get("annotate") == "true")
+	case "stats":
+		start := CanonicalURL(snap.Start)
+		if n, ok := s.Node(start); ok && n.RedirectsTo != "" {
+			start = n.RedirectsTo
+		}
+		text, err = AnalysisReport(Analyse(s, start))
+	case "markdown":
+		text, err = Markdown(s)
+	case "mermaid":
+		depth, _ := strconv.Atoi(query.Get("mermaid-depth"))
+		nodes, _ := strconv.Atoi(query.Get("mermaid-nodes"))
+		text, err = Mermaid(s, depth, nodes)
+	default:
+		text, err = Text(s)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, text)
+
+	return err
+}
+
+// writeSvg renders the given sitemap as an SVG graph using dot, in a temporary directory.
+func writeSvg(w io.Writer, s *Sitemap) error {
+	dir, err := ioutil.TempDir("", "crawler")
+	if err != nil {
+		return fmt.Errorf("error creating a temporary directory: %s", err.Error())
+	}
+
+	defer os.RemoveAll(dir)
+
+	dotFile := filepath.Join(dir, DefaultOutputFileDot)
+	svgFile := filepath.Join(dir, DefaultOutputFileSvg)
+
+	err = export(dotFile, s, writeDot)
+	if err != nil {
+		return err
+	}
+
+	err = runDot(dotFile, svgFile)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(svgFile)
+	if err != nil {
+		return fmt.Errorf("error reading the svg file: %s", err.Error())
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,309 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintln(w, `<a href="/foo">foo</a><a href="/bar">bar</a>`)
+		}
+	}))
+	defer site.Close()
+
+	s, api := getTestServer(t, "")
+	defer os.RemoveAll(s.dir)
+	defer api.Close()
+	defer s.Close()
+
+	s.SetMetrics(NewMetrics())
+
+	resp, body := request(t, http.MethodPost, api.URL+"/jobs", fmt.Sprintf(`{"url": %q, "depth": 2, "timeout": "10s"}`, site.URL))
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("POST /jobs: expected status 201, got %d: %s", resp.StatusCode, body)
+		t.FailNow()
+	}
+
+	var job Job
+	err := json.Unmarshal([]byte(body), &job)
+	if err != nil || job.Status != JobQueued || resp.Header.Get("Location") != "/jobs/"+job.ID {
+		t.Errorf("POST /jobs: expected a queued job, got %s", body)
+		t.FailNow()
+	}
+
+	job = waitForJob(t, s, job.ID, JobDone)
+	if job.Pages != 3 || job.RunID == "" {
+		t.Errorf("GET /jobs/%s: expected 3 pages crawled, got %v", job.ID, job)
+	}
+
+	resp, body = request(t, http.MethodGet, api.URL+"/jobs/"+job.ID, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"status": "done"`) {
+		t.Errorf("GET /jobs/%s: expected the job to be done, got %d: %s", job.ID, resp.StatusCode, body)
+	}
+
+	resp, body = request(t, http.MethodGet, api.URL+"/jobs", "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, job.ID) {
+		t.Errorf("GET /jobs: expected the job to be listed, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = request(t, http.MethodGet, api.URL+"/jobs/"+job.ID+"/results?format=tree", "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "(3 pages)") || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("GET /jobs/%s/results?format=tree: expected the tree of 3 pages, got %d: %s", job.ID, resp.StatusCode, body)
+	}
+
+	resp, body = request(t, http.MethodGet, api.URL+"/jobs/"+job.ID+"/results", "")
+	snap, err := readSnapshot(strings.NewReader(body))
+	if resp.StatusCode != http.StatusOK || err != nil || len(snap.Sitemap.Pages()) != 3 {
+		t.Errorf("GET /jobs/%s/results: expected a snapshot of 3 pages, got %d: %s", job.ID, resp.StatusCode, body)
+	}
+
+	resp, body = request(t, http.MethodGet, api.URL+"/jobs/"+job.ID+"/results?format=csv&table=edges", "")
+	if resp.StatusCode != http.StatusOK || strings.Count(body, "\n") != 3 {
+		t.Errorf("GET /jobs/%s/results?format=csv&table=edges: expected a header and 2 links, got %d: %s", job.ID, resp.StatusCode, body)
+	}
+
+	resp, body = request(t, http.MethodGet, api.URL+"/jobs/"+job.ID+"/results?format=pdf", "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /jobs/%s/results?format=pdf: expected status 400, got %d: %s", job.ID, resp.StatusCode, body)
+	}
+
+	resp, body = request(t, http.MethodPost, api.URL+"/jobs/"+job.ID+"/cancel", "")
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("POST /jobs/%s/cancel: expected status 409 for a finished job, got %d: %s", job.ID, resp.StatusCode, body)
+	}
+
+	resp, body = request(t, http.MethodGet, api.URL+"/metrics", "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `crawler_fetches_total{class="2xx"} 3`) {
+		t.Errorf("GET /metrics: expected the fetches of the job to be counted, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestServerRejectsInvalidRequests(t *testing.T) {
+	s, api := getTestServer(t, "")
+	defer os.RemoveAll(s.dir)
+	defer api.Close()
+	defer s.Close()
+
+	var tests = []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/jobs", `{"url": "/relative"}`, http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"url": "https://test.com", "depth": -1}`, http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"url": "https://test.com", "timeout": "soon"}`, http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"url": "https://test.com", "colour": "red"}`, http.StatusBadRequest},
+		{http.MethodPost, "/jobs", `{"url": "https://test.com/` + strings.Repeat("a", MaxJobRequestSize) + `"}`, http.StatusRequestEntityTooLarge},
+		{http.MethodGet, "/jobs/unknown", "", http.StatusNotFound},
+		{http.MethodPost, "/jobs/unknown/cancel", "", http.StatusNotFound},
+		{http.MethodGet, "/jobs/unknown/results", "", http.StatusNotFound},
+		{http.MethodDelete, "/jobs", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/pages", "", http.StatusNotFound},
+		{http.MethodGet, "/metrics", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		resp, body := request(t, test.method, api.URL+test.path, test.body)
+		if resp.StatusCode != test.status || !strings.Contains(body, `"error"`) {
+			t.Errorf("%s %s %s: expected status %d with an error, got %d: %s", test.method, test.path, test.body, test.status, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestServerCancel(t *testing.T) {
+	release := make(chan struct{})
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprintln(w, `<a href="/foo">foo</a>`)
+	}))
+	defer site.Close()
+
+	s, api := getTestServer(t, "")
+	defer os.RemoveAll(s.dir)
+	defer api.Close()
+	defer s.Close()
+
+	running, err := s.Submit(JobRequest{URL: site.URL, Depth: 0})
+	if err != nil {
+		t.Errorf("Submit(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	queued, _ := s.Submit(JobRequest{URL: site.URL, Depth: 0})
+
+	if queued.ID <= running.ID || len(s.Jobs()) != 2 {
+		t.Errorf("Submit(): expected jobs submitted one after the other to have distinct, ordered IDs, got %s and %s", running.ID, queued.ID)
+	}
+
+	waitForJob(t, s, running.ID, JobRunning)
+
+	resp, body := request(t, http.MethodPost, api.URL+"/jobs/"+queued.ID+"/cancel", "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, `"status": "cancelled"`) {
+		t.Errorf("POST /jobs/%s/cancel: expected the queued job to be cancelled, got %d: %s", queued.ID, resp.StatusCode, body)
+	}
+
+	_, err = s.Cancel(running.ID)
+	if err != nil {
+		t.Errorf("Cancel(): expected no error returned, got %s", err.Error())
+	}
+
+	// The page being fetched is interrupted, so the job finishes without waiting for it.
+	job := waitForJob(t, s, running.ID, JobCancelled)
+	if job.Finished.IsZero() || job.Pages != 0 {
+		t.Errorf("Cancel(): expected the running job to finish without the page being fetched, got %v", job)
+	}
+
+	close(release)
+
+	job, _ = s.Job(queued.ID)
+	if job.RunID != "" {
+		t.Errorf("Cancel(): expected the queued job never to run, got %v", job)
+	}
+}
+
+func TestServerResumesUnfinishedJobs(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<title>Home</title>`)
+	}))
+	defer site.Close()
+
+	dir, err := ioutil.TempDir("", "crawler-server")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// A job left running by a server which died, and a job which had already finished.
+	jobs := []Job{
+		{ID: "20181031T231858.000000000Z", Request: JobRequest{URL: site.URL}, Status: JobRunning, RunID: "lost", Pages: 5},
+		{ID: "20181031T231859.000000000Z", Request: JobRequest{URL: site.URL}, Status: JobDone},
+	}
+
+	os.MkdirAll(filepath.Join(dir, "jobs"), 0755)
+	for _, job := range jobs {
+		b, _ := json.Marshal(job)
+		ioutil.WriteFile(filepath.Join(dir, "jobs", job.ID+".json"), b, 0644)
+	}
+
+	s, api := getTestServer(t, dir)
+	defer api.Close()
+	defer s.Close()
+
+	job := waitForJob(t, s, jobs[0].ID, JobDone)
+	if job.Pages != 1 || job.RunID == "lost" {
+		t.Errorf("NewServer(): expected the unfinished job to be run again, got %v", job)
+	}
+
+	job, _ = s.Job(jobs[1].ID)
+	if job.Status != JobDone || job.RunID != "" {
+		t.Errorf("NewServer(): expected the finished job to be left alone, got %v", job)
+	}
+
+	snap, err := s.Results(jobs[0].ID)
+	if err != nil || len(snap.Sitemap.Pages()) != 1 || snap.Sitemap.Pages()[0].Title != "Home" {
+		t.Errorf("Results(): expected the page crawled by the resumed job, got %v (%v)", snap.Sitemap, err)
+	}
+}
+
+func TestServerKeepsInterruptedJobsQueued(t *testing.T) {
+	release := make(chan struct{})
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer site.Close()
+	defer close(release)
+
+	s, api := getTestServer(t, "")
+	defer os.RemoveAll(s.dir)
+	defer api.Close()
+
+	job, _ := s.Submit(JobRequest{URL: site.URL})
+	waitForJob(t, s, job.ID, JobRunning)
+
+	// The page being fetched is interrupted, so Close doesn't wait for it.
+	err := s.Close()
+	if err != nil {
+		t.Errorf("Close(): expected no error returned, got %s", err.Error())
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, "jobs", job.ID+".json"))
+	if err != nil || !strings.Contains(string(b), `"status": "queued"`) {
+		t.Errorf("Close(): expected the interrupted job to be saved as queued, got %s", b)
+	}
+
+	err = s.Close()
+	if err != nil {
+		t.Errorf("Close(): expected no error returned when closing the server again, got %s", err.Error())
+	}
+}
+
+// getTestServer returns a Server keeping its state in the given directory (a new temp dir if it's empty),
+// along with a test server serving its API.
+func getTestServer(t *testing.T, dir string) (*Server, *httptest.Server) {
+	if dir == "" {
+		var err error
+		dir, err = ioutil.TempDir("", "crawler-server")
+		if err != nil {
+			t.Fatalf("failed to create a temp dir: %s", err.Error())
+		}
+	}
+
+	s, err := NewServer(dir, 1)
+	if err != nil {
+		t.Fatalf("NewServer(): expected no error returned, got %s", err.Error())
+	}
+
+	return s, httptest.NewServer(s)
+}
+
+// waitForJob polls the given job until it has the given status (and has finished, for the final statuses),
+// failing the test if it takes too long.
+func waitForJob(t *testing.T, s *Server, id string, status JobStatus) Job {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		job, _ := s.Job(id)
+		if job.Status == status && (status == JobQueued || status == JobRunning || !job.Finished.IsZero()) {
+			return job
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected job %s to be %s, got %v", id, status, job)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func request(t *testing.T, method string, url string, body string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create a %s %s request: %s", method, url, err.Error())
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: expected no error returned, got %s", method, url, err.Error())
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("%s %s: failed to read the response body: %s", method, url, err.Error())
+	}
+
+	return resp, string(b)
+}
@@ -0,0 +1,331 @@
+package crawler
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Sitemap is the graph of the pages found while crawling and the links between them.
+// Besides the pages which were crawled, it holds pages which were linked to but never crawled
+// (e.g. because of the max depth or because fetching them failed) and external link targets.
+// A Sitemap is not safe for concurrent use.
+type Sitemap struct {
+	nodes map[CanonicalURL]*Node
+	out   map[CanonicalURL][]Edge
+	in    map[CanonicalURL][]Edge
+}
+
+// Node is a single page in the Sitemap.
+// Crawled is true if the page was fetched and parsed, in which case all its outgoing links are known.
+// Error is set if fetching the page failed, and External is set for pages outside the starting domain.
+// Depth is the crawling level the page was found at (0 for the starting page); for pages which haven't been crawled,
+// it's one level deeper than the shallowest crawled page linking to them.
+// RedirectsTo is set for pages which redirected to another page when fetched, and Attempts is the number of times
+// fetching the page was attempted (more than once if it was retried after transient failures).
+// ContentType and Size are the media type and size in bytes of crawled pages; pages which aren't HTML have no links.
+// Hash is a hash of the visible text of crawled HTML pages, and ETag and LastModified are the validators they were
+// served with, if any.
+type Node struct {
+	URL          CanonicalURL `json:"url"`
+	Crawled      bool         `json:"crawled,omitempty"`
+	External     bool         `json:"external,omitempty"`
+	Status       int          `json:"status,omitempty"`
+	Title        string       `json:"title,omitempty"`
+	Depth        int          `json:"depth"`
+	RedirectsTo  CanonicalURL `json:"redirectsTo,omitempty"`
+	Error        string       `json:"error,omitempty"`
+	Attempts     int          `json:"attempts,omitempty"`
+	ContentType  string       `json:"contentType,omitempty"`
+	Size         int64        `json:"size,omitempty"`
+	Hash         string       `json:"hash,omitempty"`
+	ETag         string       `json:"etag,omitempty"`
+	LastModified string       `json:"lastModified,omitempty"`
+}
+
+// Edge is a link from one page to another.
+// Rel is the value of the link's rel attribute and Text is its anchor text.
+type Edge struct {
+	From CanonicalURL `json:"from"`
+	To   CanonicalURL `json:"to"`
+	Rel  string       `json:"rel,omitempty"`
+	Text string       `json:"text,omitempty"`
+}
+
+// NewSitemap returns an empty Sitemap.
+func NewSitemap() *Sitemap {
+	return &Sitemap{
+		nodes: make(map[CanonicalURL]*Node),
+		out:   make(map[CanonicalURL][]Edge),
+		in:    make(map[CanonicalURL][]Edge),
+	}
+}
+
+// AddPage adds a crawled page to the sitemap, along with links to all the pages it links to.
+// If the page was already in the sitemap, its details and outgoing links are replaced.
+// If the page was the result of a redirect, the page originally requested is marked as redirecting to it.
+func (s *Sitemap) AddPage(p Page) {
+	s.AddNode(Node{URL: p.Addr, Crawled: true, Status: p.Status, Title: p.Title, Depth: p.Depth, Attempts: p.Attempts,
+		ContentType: p.ContentType, Size: p.Size, Hash: p.Hash, ETag: p.ETag, LastModified: p.LastModified})
+	s.removeOutbound(p.Addr)
+
+	for _, link := range p.Links {
+		a := p.Anchors[link]
+		s.AddEdge(Edge{From: p.Addr, To: CanonicalURL(link), Rel: a.Rel, Text: a.Text})
+	}
+
+	for _, link := range p.External {
+		a := p.Anchors[link]
+		s.AddNode(Node{URL: CanonicalURL(link), External: true, Depth: p.Depth + 1})
+		s.AddEdge(Edge{From: p.Addr, To: CanonicalURL(link), Rel: a.Rel, Text: a.Text})
+	}
+
+	if p.RedirectedFrom != "" {
+		from := s.node(CanonicalURL(p.RedirectedFrom), p.Depth)
+		from.RedirectsTo = p.Addr
+	}
+}
+
+// AddNode adds a page to the sitemap. If the page is already in the sitemap, its details are replaced,
+// unless the page has been crawled and the new details are for a page which hasn't.
+func (s *Sitemap) AddNode(n Node) {
+	existing, ok := s.nodes[n.URL]
+	if ok && existing.Crawled && !n.Crawled {
+		return
+	}
+
+	if ok && n.RedirectsTo == "" {
+		n.RedirectsTo = existing.RedirectsTo
+	}
+
+	s.nodes[n.URL] = &n
+}
+
+// AddEdge adds a link between two pages to the sitemap, adding the target page if it's not in the sitemap yet.
+// Adding a link which is already in the sitemap has no effect. The source page is added at depth 0 if it's not in the
+// sitemap yet, and keeps its depth otherwise.
+func (s *Sitemap) AddEdge(e Edge) {
+	from, ok := s.nodes[e.From]
+	if !ok {
+		from = s.node(e.From, 0)
+	}
+	s.node(e.To, from.Depth+1)
+
+	for _, existing := range s.out[e.From] {
+		if existing.To == e.To {
+			return
+		}
+	}
+
+	s.out[e.From] = append(s.out[e.From], e)
+	s.in[e.To] = append(s.in[e.To], e)
+}
+
+// Node returns the details of the given page, and whether it's in the sitemap.
+func (s *Sitemap) Node(u CanonicalURL) (Node, bool) {
+	n, ok := s.nodes[u]
+	if !ok {
+		return Node{}, false
+	}
+
+	return *n, true
+}
+
+// Crawled returns whether the given page has been crawled.
+func (s *Sitemap) Crawled(u CanonicalURL) bool {
+	n, ok := s.nodes[u]
+	return ok && n.Crawled
+}
+
+// Nodes returns all the pages in the sitemap, sorted by URL.
+func (s *Sitemap) Nodes() []Node {
+	var nodes []Node
+	for _, n := range s.nodes {
+		nodes = append(nodes, *n)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].URL < nodes[j].URL })
+
+	return nodes
+}
+
+// Pages returns the pages which have been crawled, sorted by URL.
+func (s *Sitemap) Pages() []Node {
+	var pages []Node
+	for _, n := range s.Nodes() {
+		if n.Crawled {
+			pages = append(pages, n)
+		}
+	}
+
+	return pages
+}
+
+// Edges returns all the links in the sitemap, sorted by source and then target URL.
+func (s *Sitemap) Edges() []Edge {
+	var edges []Edge
+	for _, out := range s.out {
+		edges = append(edges, out...)
+	}
+
+	sortEdges(edges)
+
+	return edges
+}
+
+// Outbound returns the links found on the given page, sorted by target URL.
+func (s *Sitemap) Outbound(u CanonicalURL) []Edge {
+	edges := append([]Edge(nil), s.out[u]...)
+	sortEdges(edges)
+
+	return edges
+}
+
+// Inbound returns the links pointing to the given page, sorted by source URL.
+func (s *Sitemap) Inbound(u CanonicalURL) []Edge {
+	edges := append([]Edge(nil), s.in[u]...)
+	sortEdges(edges)
+
+	return edges
+}
+
+// Neighbours returns the pages the given page links to or is linked from, sorted by URL.
+func (s *Sitemap) Neighbours(u CanonicalURL) []CanonicalURL {
+	seen := make(map[CanonicalURL]bool)
+	var neighbours []CanonicalURL
+
+	for _, e := range s.out[u] {
+		if !seen[e.To] {
+			seen[e.To] = true
+			neighbours = append(neighbours, e.To)
+		}
+	}
+
+	for _, e := range s.in[u] {
+		if !seen[e.From] {
+			seen[e.From] = true
+			neighbours = append(neighbours, e.From)
+		}
+	}
+
+	sort.Slice(neighbours, func(i, j int) bool { return neighbours[i] < neighbours[j] })
+
+	return neighbours
+}
+
+// Walk traverses the sitemap breadth-first following outgoing links, starting from the given page,
+// calling fn for every page reachable from it along with the min number of links needed to get to it.
+// Pages at the same distance are visited in URL order. The walk stops as soon as fn returns false.
+func (s *Sitemap) Walk(start CanonicalURL, fn func(n Node, distance int) bool) {
+	if _, ok := s.nodes[start]; !ok {
+		return
+	}
+
+	distances := map[CanonicalURL]int{start: 0}
+	queue := []CanonicalURL{start}
+
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+
+		if !fn(*s.nodes[u], distances[u]) {
+			return
+		}
+
+		for _, e := range s.Outbound(u) {
+			if _, seen := distances[e.To]; !seen {
+				distances[e.To] = distances[u] + 1
+				queue = append(queue, e.To)
+			}
+		}
+	}
+}
+
+// Internal returns a copy of the sitemap without the external pages and the links pointing to them.
+func (s *Sitemap) Internal() *Sitemap {
+	internal := NewSitemap()
+
+	for u, n := range s.nodes {
+		if !n.External {
+			c := *n
+			internal.nodes[u] = &c
+		}
+	}
+
+	for _, e := range s.Edges() {
+		if !s.nodes[e.From].External && !s.nodes[e.To].External {
+			internal.out[e.From] = append(internal.out[e.From], e)
+			internal.in[e.To] = append(internal.in[e.To], e)
+		}
+	}
+
+	return internal
+}
+
+type sitemapJSON struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// MarshalJSON encodes the sitemap as lists of nodes and edges.
+func (s *Sitemap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sitemapJSON{Nodes: s.Nodes(), Edges: s.Edges()})
+}
+
+// UnmarshalJSON decodes a sitemap encoded with MarshalJSON.
+func (s *Sitemap) UnmarshalJSON(b []byte) error {
+	var data sitemapJSON
+
+	err := json.Unmarshal(b, &data)
+	if err != nil {
+		return err
+	}
+
+	*s = *NewSitemap()
+
+	for _, n := range data.Nodes {
+		s.AddNode(n)
+	}
+
+	for _, e := range data.Edges {
+		s.AddEdge(e)
+	}
+
+	return nil
+}
+
+// node returns the given page, adding it to the sitemap at the given depth if it's not in the sitemap yet.
+// Pages which haven't been crawled or failed to be fetched are moved up to the given depth if they're deeper.
+func (s *Sitemap) node(u CanonicalURL, depth int) *Node {
+	n, ok := s.nodes[u]
+	if !ok {
+		n = &Node{URL: u, Depth: depth}
+		s.nodes[u] = n
+	} else if !n.Crawled && n.Error == "" && depth < n.Depth {
+		n.Depth = depth
+	}
+
+	return n
+}
+
+func (s *Sitemap) removeOutbound(u CanonicalURL) {
+	for _, e := range s.out[u] {
+		var in []Edge
+		for _, ie := range s.in[e.To] {
+			if ie.From != u {
+				in = append(in, ie)
+			}
+		}
+		s.in[e.To] = in
+	}
+
+	delete(s.out, u)
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
@@ -0,0 +1,163 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSitemapAddPage(t *testing.T) {
+	s := NewSitemap()
+	s.AddPage(Page{
+		Addr:           CanonicalURL("https://test.com/home"),
+		Links:          Links{"https://test.com/foo"},
+		External:       Links{"https://other.com"},
+		Status:         200,
+		Title:          "Home",
+		Anchors:        map[string]Anchor{"https://other.com": {Rel: "nofollow", Text: "Elsewhere"}},
+		RedirectedFrom: "https://test.com",
+	})
+
+	home, ok := s.Node(CanonicalURL("https://test.com/home"))
+	if !ok || !home.Crawled || home.Status != 200 || home.Title != "Home" {
+		t.Errorf("AddPage(): expected the page to be crawled with its details, got %v", home)
+	}
+
+	foo, ok := s.Node(CanonicalURL("https://test.com/foo"))
+	if !ok || foo.Crawled || foo.External || foo.Depth != 1 {
+		t.Errorf("AddPage(): expected the link target to be added one level deeper, got %v", foo)
+	}
+
+	other, ok := s.Node(CanonicalURL("https://other.com"))
+	if !ok || other.Crawled || !other.External {
+		t.Errorf("AddPage(): expected the external link target to be added, got %v", other)
+	}
+
+	start, ok := s.Node(CanonicalURL("https://test.com"))
+	if !ok || start.RedirectsTo != "https://test.com/home" {
+		t.Errorf("AddPage(): expected the original page to redirect to https://test.com/home, got %v", start)
+	}
+
+	expected := Edge{From: "https://test.com/home", To: "https://other.com", Rel: "nofollow", Text: "Elsewhere"}
+	if in := s.Inbound(CanonicalURL("https://other.com")); len(in) != 1 || in[0] != expected {
+		t.Errorf("AddPage(): expected link %v, got %v", expected, in)
+	}
+
+	// Crawling the page again replaces its links.
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com/home"), Links: Links{"https://test.com/bar"}, Status: 200})
+
+	if out := s.Outbound(CanonicalURL("https://test.com/home")); len(out) != 1 || out[0].To != "https://test.com/bar" {
+		t.Errorf("AddPage(): expected the links to be replaced, got %v", out)
+	}
+
+	if in := s.Inbound(CanonicalURL("https://test.com/foo")); len(in) != 0 {
+		t.Errorf("AddPage(): expected the old links to be removed, got %v", in)
+	}
+}
+
+func TestSitemapAddNodeKeepsCrawledPages(t *testing.T) {
+	s := getTestSitemap()
+	s.AddNode(Node{URL: CanonicalURL("https://test.com/foo"), Depth: 5})
+
+	foo, _ := s.Node(CanonicalURL("https://test.com/foo"))
+	if !foo.Crawled || foo.Status != 404 || foo.Depth != 1 {
+		t.Errorf("AddNode(): expected the crawled page not to be replaced, got %v", foo)
+	}
+}
+
+func TestSitemapAddEdge(t *testing.T) {
+	s := NewSitemap()
+	s.AddEdge(Edge{From: "https://test.com", To: "https://test.com/foo"})
+	s.AddEdge(Edge{From: "https://test.com", To: "https://test.com/foo", Text: "Again"})
+
+	if len(s.Nodes()) != 2 || len(s.Edges()) != 1 {
+		t.Errorf("AddEdge(): expected 2 pages and 1 link, got %v and %v", s.Nodes(), s.Edges())
+	}
+
+	// Links from a page which hasn't been crawled don't move it up.
+	s.AddEdge(Edge{From: "https://test.com/foo", To: "https://test.com/bar"})
+
+	foo, _ := s.Node(CanonicalURL("https://test.com/foo"))
+	bar, _ := s.Node(CanonicalURL("https://test.com/bar"))
+	if foo.Depth != 1 || bar.Depth != 2 {
+		t.Errorf("AddEdge(): expected the pages at depths 1 and 2, got %v and %v", foo, bar)
+	}
+}
+
+func TestSitemapNeighbours(t *testing.T) {
+	actual := getTestSitemap().Neighbours(CanonicalURL("https://test.com/foo"))
+	expected := []CanonicalURL{"https://test.com", "https://test.com/bar", "https://test.com/baz"}
+
+	assertPages(t, "Neighbours", actual, expected...)
+}
+
+func TestSitemapWalk(t *testing.T) {
+	var visited []string
+
+	getTestSitemap().Walk(CanonicalURL("https://test.com"), func(n Node, distance int) bool {
+		visited = append(visited, fmt.Sprintf("%s:%d", n.URL, distance))
+		return true
+	})
+
+	expected := "https://test.com:0 https://test.com/bar:1 https://test.com/foo:1 https://test.com/baz:2"
+	if strings.Join(visited, " ") != expected {
+		t.Errorf("Walk(): expected %s, got %v", expected, visited)
+	}
+
+	count := 0
+	getTestSitemap().Walk(CanonicalURL("https://test.com"), func(n Node, distance int) bool {
+		count++
+		return count < 2
+	})
+
+	if count != 2 {
+		t.Errorf("Walk(): expected the walk to stop after 2 pages, visited %d", count)
+	}
+}
+
+func TestSitemapInternal(t *testing.T) {
+	s := getTestSitemap()
+	s.AddPage(Page{Addr: CanonicalURL("https://test.com/baz"), External: Links{"https://other.com"}, Status: 200, Depth: 2})
+
+	internal := s.Internal()
+
+	if len(internal.Nodes()) != 4 || len(internal.Edges()) != 6 {
+		t.Errorf("Internal(): expected 4 pages and 6 links, got %v and %v", internal.Nodes(), internal.Edges())
+	}
+
+	if _, ok := internal.Node(CanonicalURL("https://other.com")); ok {
+		t.Error("Internal(): expected the external page to be removed")
+	}
+
+	if len(s.Nodes()) != 5 {
+		t.Errorf("Internal(): expected the original sitemap to be unchanged, got %v", s.Nodes())
+	}
+}
+
+func TestSitemapJSONRoundTrip(t *testing.T) {
+	expected := getTestSitemap()
+
+	b, err := json.Marshal(expected)
+	if err != nil {
+		t.Errorf("MarshalJSON(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	actual := NewSitemap()
+	err = json.Unmarshal(b, actual)
+	if err != nil {
+		t.Errorf("UnmarshalJSON(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if len(actual.Nodes()) != len(expected.Nodes()) || len(actual.Edges()) != len(expected.Edges()) {
+		t.Errorf("UnmarshalJSON(): expected %v, got %v", expected.Edges(), actual.Edges())
+	}
+
+	for i, n := range expected.Nodes() {
+		if actual.Nodes()[i] != n {
+			t.Errorf("UnmarshalJSON(): expected page %v, got %v", n, actual.Nodes()[i])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Snapshot holds the results of a single crawl, so that they can be saved and compared with other crawls later.
+type Snapshot struct {
+	Start   string    `json:"start"`
+	Time    time.Time `json:"time"`
+	Sitemap *Sitemap  `json:"sitemap"`
+}
+
+// SaveSnapshot saves the given snapshot to a JSON file.
+func SaveSnapshot(file string, snap Snapshot) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("error creating the snapshot file %s: %s", file, err.Error())
+	}
+
+	defer f.Close()
+
+	err = writeSnapshot(f, snap)
+	if err != nil {
+		return fmt.Errorf("error saving the snapshot to %s: %s", file, err.Error())
+	}
+
+	return nil
+}
+
+// LoadSnapshot loads a snapshot previously saved with SaveSnapshot.
+func LoadSnapshot(file string) (Snapshot, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error opening the snapshot file %s: %s", file, err.Error())
+	}
+
+	defer f.Close()
+
+	snap, err := readSnapshot(f)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error loading the snapshot from %s: %s", file, err.Error())
+	}
+
+	return snap, nil
+}
+
+func writeSnapshot(w io.Writer, snap Snapshot) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(snap)
+}
+
+func readSnapshot(r io.Reader) (Snapshot, error) {
+	var snap Snapshot
+
+	err := json.NewDecoder(r).Decode(&snap)
+	if err != nil {
+		return snap, err
+	}
+
+	if snap.Sitemap == nil {
+		snap.Sitemap = NewSitemap()
+	}
+
+	return snap, nil
+}
@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	expected := Snapshot{
+		Start:   "https://test.com",
+		Time:    time.Date(2018, 10, 31, 23, 0, 0, 0, time.UTC),
+		Sitemap: getTestSitemap(),
+	}
+
+	var b bytes.Buffer
+
+	err := writeSnapshot(&b, expected)
+	if err != nil {
+		t.Errorf("writeSnapshot(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	actual, err := readSnapshot(&b)
+	if err != nil {
+		t.Errorf("readSnapshot(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if actual.Start != expected.Start || !actual.Time.Equal(expected.Time) {
+		t.Errorf("readSnapshot(): expected start %s and time %s, got %s and %s", expected.Start, expected.Time, actual.Start, actual.Time)
+	}
+
+	if len(actual.Sitemap.Nodes()) != len(expected.Sitemap.Nodes()) || len(actual.Sitemap.Edges()) != len(expected.Sitemap.Edges()) {
+		t.Errorf("readSnapshot(): expected sitemap %v, got %v", expected.Sitemap.Edges(), actual.Sitemap.Edges())
+	}
+
+	foo, _ := actual.Sitemap.Node(CanonicalURL("https://test.com/foo"))
+	if !foo.Crawled || foo.Status != 404 || foo.Title != "Foo & friends" || foo.Depth != 1 {
+		t.Errorf("readSnapshot(): expected page details to be preserved, got %v", foo)
+	}
+
+	e := actual.Sitemap.Outbound(CanonicalURL("https://test.com"))[2]
+	if e.To != "https://test.com/foo" || e.Rel != "nofollow" || e.Text != "Go to foo" {
+		t.Errorf("readSnapshot(): expected link details to be preserved, got %v", e)
+	}
+}
+
+func TestReadSnapshotReturnsErrorForInvalidJSON(t *testing.T) {
+	_, err := readSnapshot(strings.NewReader("{not json"))
+	if err == nil {
+		t.Error("readSnapshot(invalid): expected an error to be returned, got none")
+	}
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"time"
+)
+
+// Stats is a snapshot of the progress of a crawl.
+// Pages is the number of pages fetched, and Errors the number of pages which couldn't be fetched.
+// NotModified is the number of pages fetched which weren't modified since the previous crawl (see Crawler.SetPrevious).
+// Queued is the number of links found which are waiting to be visited (some of which may turn out to be visited already).
+// Finished is the zero time while the crawl is still running.
+// Connections counts the connections opened and reused to fetch the pages.
+type Stats struct {
+	Pages       int       `json:"pages"`
+	Errors      int       `json:"errors"`
+	NotModified int       `json:"notModified"`
+	Queued      int       `json:"queued"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished"`
+	Connections ConnStats `json:"connections"`
+}
+
+// Stats returns a snapshot of the progress of the crawl. It's safe to call while Crawl is running,
+// e.g. from another goroutine to display the progress.
+func (c *Crawler) Stats() Stats {
+	c.sMutex.Lock()
+	stats := c.stats
+	c.sMutex.Unlock()
+
+	stats.Connections = c.parser.connStats()
+
+	return stats
+}
+
+// Elapsed returns the time spent crawling so far, or the total crawling time once the crawl has finished.
+func (s Stats) Elapsed() time.Duration {
+	if s.Started.IsZero() {
+		return 0
+	}
+
+	if s.Finished.IsZero() {
+		return time.Since(s.Started)
+	}
+
+	return s.Finished.Sub(s.Started)
+}
+
+// Rate returns the average number of pages fetched (or failed) per second.
+func (s Stats) Rate() float64 {
+	elapsed := s.Elapsed().Seconds()
+	if elapsed == 0 {
+		return 0
+	}
+
+	return float64(s.Pages+s.Errors) / elapsed
+}
@@ -0,0 +1,73 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var c Crawler
+	during := make(map[string]Stats)
+
+	// Links are visited in any order, so the root only links to foo, whose two links are fetched in either order.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintln(w, `<a href="/foo">foo</a>`)
+		case "/foo":
+			fmt.Fprintln(w, `<a href="/bar">bar</a><a href="/baz">baz</a>`)
+		case "/bar", "/baz":
+			during[r.URL.Path] = c.Stats()
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Stats(): failed to parse test server addr %s as URL", ts.URL)
+	}
+
+	c = NewCrawler(tsURL, 0)
+
+	if !c.Stats().Started.IsZero() || c.Stats().Elapsed() != 0 || c.Stats().Rate() != 0 {
+		t.Errorf("Stats(): expected no progress before crawling, got %v", c.Stats())
+	}
+
+	c.Crawl(context.TODO())
+
+	first, second := during["/bar"], during["/baz"]
+	if first.Pages > second.Pages {
+		first, second = second, first
+	}
+
+	// The root and foo have been fetched, and one of foo's links is still waiting while the other one is fetched.
+	if first.Pages != 2 || first.Queued != 1 || first.Started.IsZero() || !first.Finished.IsZero() {
+		t.Errorf("Stats(): expected 2 pages fetched and 1 queued while crawling, got %v", first)
+	}
+
+	if second.Pages != 3 || second.Queued != 0 {
+		t.Errorf("Stats(): expected 3 pages fetched and nothing queued while fetching the last page, got %v", second)
+	}
+
+	stats := c.Stats()
+	if stats.Pages != 4 || stats.Errors != 0 || stats.Queued != 0 {
+		t.Errorf("Stats(): expected 4 pages fetched and nothing queued, got %v", stats)
+	}
+
+	if stats.Finished.IsZero() || stats.Elapsed() != stats.Finished.Sub(stats.Started) || stats.Rate() <= 0 {
+		t.Errorf("Stats(): expected the crawl to be finished with a positive rate, got %v", stats)
+	}
+}
+
+func TestStatsCountsErrors(t *testing.T) {
+	c := NewCrawler(&url.URL{}, 2)
+	c.parsePage(context.TODO(), "", 1)
+
+	if stats := c.Stats(); stats.Errors != 1 || stats.Pages != 0 {
+		t.Errorf("Stats(): expected 1 error, got %v", stats)
+	}
+}
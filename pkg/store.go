@@ -0,0 +1,289 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownRun is returned by a Store when asked about a crawl run it doesn't hold.
+var ErrUnknownRun = errors.New("unknown crawl run")
+
+// Run describes a single crawl run saved in a Store.
+// Finished is the zero time if the run is still in progress, or if the process died before the crawl completed.
+type Run struct {
+	ID       string            `json:"id"`
+	Start    string            `json:"start"`
+	Started  time.Time         `json:"started"`
+	Finished time.Time         `json:"finished"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Store persists crawl results as they're discovered, so that they survive the process dying,
+// and so that later runs can be queried and compared.
+type Store interface {
+	// CreateRun records the beginning of a new crawl run from the given starting URL.
+	CreateRun(start string, metadata map[string]string) (Run, error)
+
+	// SavePage records a page (along with its outgoing links) found during the given run.
+	// Saving a page with the same address again replaces it.
+	SavePage(runID string, p Page) error
+
+	// FinishRun records the end of the given run.
+	FinishRun(runID string) error
+
+	// Runs returns all the runs in the store, oldest first.
+	Runs() ([]Run, error)
+
+	// Snapshot returns the results of the given run, including runs which haven't finished.
+	Snapshot(runID string) (Snapshot, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// FileStore is a Store which saves crawl runs in a directory on disk, with no external dependencies.
+// Every run gets its own sub-directory, holding a run.json file with the run's details
+// and an append-only pages.jsonl file with one JSON-encoded page per line.
+// Pages are appended as soon as they're saved, so a run interrupted mid-crawl can still be loaded.
+type FileStore struct {
+	dir   string
+	mutex sync.Mutex
+	files map[string]*os.File
+	now   func() time.Time
+}
+
+// NewFileStore returns a FileStore saving crawl runs in the given directory, which is created if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the store directory %s: %s", dir, err.Error())
+	}
+
+	return &FileStore{dir: dir, files: make(map[string]*os.File), now: time.Now}, nil
+}
+
+// CreateRun records the beginning of a new crawl run. Run IDs are based on the current time, so they sort chronologically.
+// Existing runs are never overwritten: if a run with the same ID was created at the same time (e.g. by another FileStore
+// for the same directory), the ID of the next nanosecond is used instead.
+func (s *FileStore) CreateRun(start string, metadata map[string]string) (Run, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now().UTC()
+	run := Run{ID: now.Format("20060102T150405.000000000Z"), Start: start, Started: now, Metadata: metadata}
+
+	err := os.Mkdir(s.runDir(run.ID), 0755)
+	for os.IsExist(err) {
+		now = now.Add(time.Nanosecond)
+		run.ID, run.Started = now.Format("20060102T150405.000000000Z"), now
+
+		err = os.Mkdir(s.runDir(run.ID), 0755)
+	}
+
+	if err != nil {
+		return run, fmt.Errorf("error creating the run directory: %s", err.Error())
+	}
+
+	err = s.writeRun(run)
+	if err != nil {
+		return run, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.runDir(run.ID), "pages.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return run, fmt.Errorf("error creating the pages file: %s", err.Error())
+	}
+
+	s.files[run.ID] = f
+
+	return run, nil
+}
+
+// SavePage appends the given page to the run's pages file.
+func (s *FileStore) SavePage(runID string, p Page) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("error encoding page %s: %s", p.Addr, err.Error())
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f, ok := s.files[runID]
+	if !ok {
+		return ErrUnknownRun
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		return fmt.Errorf("error saving page %s: %s", p.Addr, err.Error())
+	}
+
+	return nil
+}
+
+// FinishRun records the end of the given run and closes its pages file.
+func (s *FileStore) FinishRun(runID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f, ok := s.files[runID]
+	if !ok {
+		return ErrUnknownRun
+	}
+
+	delete(s.files, runID)
+
+	err := f.Close()
+	if err != nil {
+		return fmt.Errorf("error closing the pages file: %s", err.Error())
+	}
+
+	run, err := s.readRun(runID)
+	if err != nil {
+		return err
+	}
+
+	run.Finished = time.Now().UTC()
+
+	return s.writeRun(run)
+}
+
+// Runs returns all the runs in the store, oldest first.
+func (s *FileStore) Runs() ([]Run, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the store directory %s: %s", s.dir, err.Error())
+	}
+
+	var runs []Run
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		run, err := s.readRun(e.Name())
+		if err != nil {
+			continue
+		}
+
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Started.Before(runs[j].Started) })
+
+	return runs, nil
+}
+
+// Snapshot loads the results of the given run from its pages file.
+// A truncated last line (e.g. if the process died while writing it) is ignored.
+func (s *FileStore) Snapshot(runID string) (Snapshot, error) {
+	run, err := s.readRun(runID)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snap := Snapshot{Start: run.Start, Time: run.Started, Sitemap: NewSitemap()}
+
+	f, err := os.Open(filepath.Join(s.runDir(runID), "pages.jsonl"))
+	if err != nil {
+		return snap, fmt.Errorf("error opening the pages file: %s", err.Error())
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var p Page
+
+		err := json.Unmarshal(scanner.Bytes(), &p)
+		if err != nil {
+			continue
+		}
+
+		if p.Error == "" {
+			snap.Sitemap.AddPage(p)
+		} else {
+			snap.Sitemap.AddNode(Node{URL: p.Addr, Depth: p.Depth, Error: p.Error, Attempts: p.Attempts})
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return snap, fmt.Errorf("error reading the pages file: %s", err.Error())
+	}
+
+	return snap, nil
+}
+
+// Close closes the pages files of any runs which haven't been finished.
+func (s *FileStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var firstErr error
+	for id, f := range s.files {
+		err := f.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.files, id)
+	}
+
+	return firstErr
+}
+
+func (s *FileStore) runDir(runID string) string {
+	return filepath.Join(s.dir, runID)
+}
+
+func (s *FileStore) readRun(runID string) (Run, error) {
+	var run Run
+
+	b, err := ioutil.ReadFile(filepath.Join(s.runDir(runID), "run.json"))
+	if os.IsNotExist(err) {
+		return run, ErrUnknownRun
+	}
+	if err != nil {
+		return run, fmt.Errorf("error reading run %s: %s", runID, err.Error())
+	}
+
+	err = json.Unmarshal(b, &run)
+	if err != nil {
+		return run, fmt.Errorf("error decoding run %s: %s", runID, err.Error())
+	}
+
+	return run, nil
+}
+
+// writeRun saves the run details to a temporary file first, so that run.json is never left half-written.
+func (s *FileStore) writeRun(run Run) error {
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding run %s: %s", run.ID, err.Error())
+	}
+
+	tmp := filepath.Join(s.runDir(run.ID), "run.json.tmp")
+
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return fmt.Errorf("error saving run %s: %s", run.ID, err.Error())
+	}
+
+	err = os.Rename(tmp, filepath.Join(s.runDir(run.ID), "run.json"))
+	if err != nil {
+		return fmt.Errorf("error saving run %s: %s", run.ID, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-store")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore(): expected no error returned, got %s", err.Error())
+	}
+	defer s.Close()
+
+	run, err := s.CreateRun("https://test.com", map[string]string{"release": "v1"})
+	if err != nil {
+		t.Errorf("CreateRun(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	for _, p := range getTestPages() {
+		err := s.SavePage(run.ID, p)
+		if err != nil {
+			t.Errorf("SavePage(): expected no error returned, got %s", err.Error())
+		}
+	}
+
+	err = s.SavePage(run.ID, Page{Addr: "https://test.com/gone", Error: "connection refused"})
+	if err != nil {
+		t.Errorf("SavePage(): expected no error returned, got %s", err.Error())
+	}
+
+	// Runs can be loaded before they're finished, e.g. if the crawler died mid-crawl.
+	snap, err := s.Snapshot(run.ID)
+	if err != nil {
+		t.Errorf("Snapshot(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if snap.Start != "https://test.com" || len(snap.Sitemap.Pages()) != 4 {
+		t.Errorf("Snapshot(): expected 4 pages crawled from https://test.com, got %v", snap.Sitemap.Pages())
+	}
+
+	if foo, _ := snap.Sitemap.Node("https://test.com/foo"); foo.Title != "Foo & friends" {
+		t.Errorf("Snapshot(): expected page details to be preserved, got %v", foo)
+	}
+
+	if gone, _ := snap.Sitemap.Node("https://test.com/gone"); gone.Error != "connection refused" {
+		t.Errorf("Snapshot(): expected the failed page to be recorded, got %v", gone)
+	}
+
+	err = s.FinishRun(run.ID)
+	if err != nil {
+		t.Errorf("FinishRun(): expected no error returned, got %s", err.Error())
+	}
+
+	runs, err := s.Runs()
+	if err != nil {
+		t.Errorf("Runs(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if len(runs) != 1 || runs[0].ID != run.ID || runs[0].Finished.IsZero() || runs[0].Metadata["release"] != "v1" {
+		t.Errorf("Runs(): expected the finished run %s, got %v", run.ID, runs)
+	}
+}
+
+func TestFileStoreIgnoresTruncatedPages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-store")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore(): expected no error returned, got %s", err.Error())
+	}
+	defer s.Close()
+
+	run, err := s.CreateRun("https://test.com", nil)
+	if err != nil {
+		t.Fatalf("CreateRun(): expected no error returned, got %s", err.Error())
+	}
+
+	s.SavePage(run.ID, Page{Addr: "https://test.com", Links: Links{"https://test.com/foo"}})
+	s.files[run.ID].WriteString(`{"addr":"https://test.com/foo","lin`)
+
+	snap, err := s.Snapshot(run.ID)
+	if err != nil {
+		t.Errorf("Snapshot(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if len(snap.Sitemap.Pages()) != 1 {
+		t.Errorf("Snapshot(): expected the truncated page to be ignored, got %v", snap.Sitemap.Pages())
+	}
+}
+
+func TestFileStoreReturnsErrorsForUnknownRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-store")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(filepath.Join(dir, "nested"))
+	if err != nil {
+		t.Fatalf("NewFileStore(): expected no error returned, got %s", err.Error())
+	}
+
+	if err := s.SavePage("foo", Page{}); err != ErrUnknownRun {
+		t.Errorf("SavePage(unknown): expected error %v, got %v", ErrUnknownRun, err)
+	}
+
+	if err := s.FinishRun("foo"); err != ErrUnknownRun {
+		t.Errorf("FinishRun(unknown): expected error %v, got %v", ErrUnknownRun, err)
+	}
+
+	if _, err := s.Snapshot("foo"); err != ErrUnknownRun {
+		t.Errorf("Snapshot(unknown): expected error %v, got %v", ErrUnknownRun, err)
+	}
+}
+
+func TestFileStoreCreatesDistinctRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-store")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// Runs are created at the same time by two stores for the same directory, e.g. by the two sides of a comparison.
+	now := time.Now()
+
+	var stores []*FileStore
+	for i := 0; i < 2; i++ {
+		s, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatalf("NewFileStore(): expected no error returned, got %s", err.Error())
+		}
+		defer s.Close()
+
+		s.now = func() time.Time { return now }
+
+		stores = append(stores, s)
+	}
+
+	var wg sync.WaitGroup
+	ids := make([]string, 20)
+
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			run, err := stores[i%2].CreateRun("https://test.com", map[string]string{"run": fmt.Sprint(i)})
+			if err != nil {
+				t.Errorf("CreateRun(): expected no error returned, got %s", err.Error())
+			}
+			ids[i] = run.ID
+		}(i)
+	}
+
+	wg.Wait()
+
+	runs, err := stores[0].Runs()
+	if err != nil {
+		t.Errorf("Runs(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if len(runs) != len(ids) {
+		t.Errorf("CreateRun(): expected %d distinct runs, got %v", len(ids), runs)
+	}
+
+	for i, id := range ids {
+		run, err := stores[0].readRun(id)
+		if err != nil || run.Metadata["run"] != fmt.Sprint(i) {
+			t.Errorf("CreateRun(): expected run %s to be the one created by goroutine %d, got %v and %v", id, i, run, err)
+		}
+	}
+}
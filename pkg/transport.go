@@ -0,0 +1,223 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultKeepAlive is how long idle connections are kept open to be reused by default.
+	DefaultKeepAlive = 90 * time.Second
+
+	// DefaultMaxIdleConnsPerHost is the default max number of idle connections kept open to each host.
+	DefaultMaxIdleConnsPerHost = 10
+
+	// DefaultDialTimeout is the default max amount of time allowed to open a connection.
+	DefaultDialTimeout = 10 * time.Second
+
+	// DefaultTLSHandshakeTimeout is the default max amount of time allowed for a TLS handshake.
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+)
+
+// LoadTLSConfig returns the TLS configuration used to connect to sites with certificates signed by a custom CA,
+// or requiring a client certificate (mTLS). All the arguments are optional:
+//
+//   - caFile is a PEM bundle of CA certificates trusted on top of the system ones, e.g. for a staging CA.
+//   - certFile and keyFile are the PEM client certificate and its private key, which must be given together.
+//   - insecure disables the verification of server certificates altogether, e.g. for self-signed certificates.
+//     Connections can then be intercepted, so it should only be used for sites which can't be verified otherwise.
+func LoadTLSConfig(caFile string, certFile string, keyFile string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the CA bundle: %s", err.Error())
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("error reading the CA bundle %s: no PEM certificates found", caFile)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("error loading the client certificate: both a certificate and a key file are required")
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the client certificate: %s", err.Error())
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// newTransport returns the transport all the pages of a crawl are fetched with, so that connections are reused
+// from one page to the next. It's tuned by the given options, going through their proxy and using their TLS configuration.
+func newTransport(o FetchOptions) *http.Transport {
+	keepAlive := o.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAlive
+	}
+
+	maxIdle := o.MaxIdleConnsPerHost
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdleConnsPerHost
+	}
+
+	dialTimeout := o.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = DefaultDialTimeout
+	}
+
+	tlsTimeout := o.TLSHandshakeTimeout
+	if tlsTimeout <= 0 {
+		tlsTimeout = DefaultTLSHandshakeTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: keepAlive}
+
+	t := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialContext(o, dialer),
+		ForceAttemptHTTP2:   !o.DisableHTTP2,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: maxIdle,
+		IdleConnTimeout:     keepAlive,
+		DisableKeepAlives:   keepAlive < 0,
+		TLSHandshakeTimeout: tlsTimeout,
+	}
+
+	if o.Proxy != nil {
+		t.Proxy = http.ProxyURL(o.Proxy)
+	}
+
+	if o.TLS != nil {
+		t.TLSClientConfig = o.TLS.Clone()
+	}
+
+	// A non-nil empty map stops the transport from upgrading TLS connections to HTTP/2.
+	if o.DisableHTTP2 {
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	return t
+}
+
+// dialContext returns the function connections are opened with: the custom dial function of the given options,
+// or else the given dialer, connecting to the addresses the hosts are resolved to by the options if they're overridden.
+func dialContext(o FetchOptions, dialer *net.Dialer) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	dial := o.Dial
+	if dial == nil {
+		dial = dialer.DialContext
+	}
+
+	if len(o.Resolve) == 0 {
+		return dial
+	}
+
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		network, addr = resolve(o.Resolve, network, addr)
+		return dial(ctx, network, addr)
+	}
+}
+
+// resolve returns the network and address to connect to instead of the given address (host and port), if there's
+// an override for it: either for the host and port, or for the host on any port. The overriding address keeps
+// the requested port if it doesn't have one, and unix:// addresses are unix sockets.
+func resolve(overrides map[string]string, network string, addr string) (string, string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return network, addr
+	}
+
+	target, ok := overrides[addr]
+	if !ok {
+		target, ok = overrides[host]
+	}
+
+	if !ok {
+		return network, addr
+	}
+
+	if strings.HasPrefix(target, "unix://") {
+		return "unix", strings.TrimPrefix(target, "unix://")
+	}
+
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, port)
+	}
+
+	return network, target
+}
+
+// ConnStats counts the connections pages were fetched over. Opened is the number of connections opened,
+// and Reused the number of requests sent over a connection which had already been used, instead of a new one.
+type ConnStats struct {
+	Opened int64 `json:"opened"`
+	Reused int64 `json:"reused"`
+}
+
+// ReuseRate returns the share of requests which were sent over an existing connection, between 0 and 1.
+func (s ConnStats) ReuseRate() float64 {
+	if s.Opened+s.Reused == 0 {
+		return 0
+	}
+
+	return float64(s.Reused) / float64(s.Opened+s.Reused)
+}
+
+// connStats counts the connections of a Parser. It's shared by the copies of the Parser, and safe for concurrent use.
+type connStats struct {
+	opened int64
+	reused int64
+}
+
+// gotConn records a connection obtained for a request, and whether it was reused.
+func (p *Parser) gotConn(info httptrace.GotConnInfo) {
+	if p.conns != nil {
+		if info.Reused {
+			atomic.AddInt64(&p.conns.reused, 1)
+		} else {
+			atomic.AddInt64(&p.conns.opened, 1)
+		}
+	}
+
+	p.metrics.connection(info.Reused)
+}
+
+// connStats returns the connections the Parser has fetched pages over so far.
+func (p *Parser) connStats() ConnStats {
+	if p.conns == nil {
+		return ConnStats{}
+	}
+
+	return ConnStats{Opened: atomic.LoadInt64(&p.conns.opened), Reused: atomic.LoadInt64(&p.conns.reused)}
+}
+
+// close closes the idle connections of the Parser's transport.
+func (p *Parser) close() {
+	if p.base != nil {
+		p.base.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,423 @@
+package crawler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseVerifiesServerCertificates(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "crawler-tls")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	ca := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644)
+
+	var tests = []struct {
+		caFile   string
+		insecure bool
+		valid    bool
+	}{
+		{"", false, false},
+		{ca, false, true},
+		{"", true, true},
+	}
+
+	for _, test := range tests {
+		cfg, err := LoadTLSConfig(test.caFile, "", "", test.insecure)
+		if err != nil {
+			t.Errorf("LoadTLSConfig(): expected no error returned, got %s", err.Error())
+			t.FailNow()
+		}
+
+		u, _ := url.Parse(ts.URL)
+
+		p := NewParser(u.Scheme, u.Host)
+		p.SetFetchOptions(FetchOptions{TLS: cfg})
+
+		_, err = p.parse(context.TODO(), ts.URL)
+		if test.valid && err != nil {
+			t.Errorf("parse(): expected no error returned with CA %q and insecure %t, got %s", test.caFile, test.insecure, err.Error())
+		}
+
+		if !test.valid && (err == nil || errorType(err) != "tls") {
+			t.Errorf("parse(): expected a TLS error with CA %q and insecure %t, got %v", test.caFile, test.insecure, err)
+		}
+	}
+}
+
+func TestParseSendsClientCertificate(t *testing.T) {
+	var subject string
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "crawler-tls")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeClientCertificate(t, dir, "crawler")
+
+	u, _ := url.Parse(ts.URL)
+
+	p := NewParser(u.Scheme, u.Host)
+	p.SetFetchOptions(FetchOptions{TLS: &tls.Config{InsecureSkipVerify: true}})
+
+	_, err = p.parse(context.TODO(), ts.URL)
+	if err == nil {
+		t.Errorf("parse(): expected an error returned without a client certificate")
+	}
+
+	cfg, err := LoadTLSConfig("", certFile, keyFile, true)
+	if err != nil {
+		t.Errorf("LoadTLSConfig(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	p.SetFetchOptions(FetchOptions{TLS: cfg})
+
+	_, err = p.parse(context.TODO(), ts.URL)
+	if err != nil {
+		t.Errorf("parse(): expected no error returned with a client certificate, got %s", err.Error())
+	}
+
+	if subject != "crawler" {
+		t.Errorf("parse(): expected the client certificate to be sent, got subject %q", subject)
+	}
+}
+
+func TestLoadTLSConfigReturnsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crawler-tls")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	empty := filepath.Join(dir, "empty.pem")
+	ioutil.WriteFile(empty, []byte("not a certificate"), 0644)
+
+	certFile, _ := writeClientCertificate(t, dir, "crawler")
+
+	var tests = []struct {
+		caFile   string
+		certFile string
+		keyFile  string
+		expected string
+	}{
+		{filepath.Join(dir, "missing.pem"), "", "", "error reading the CA bundle"},
+		{empty, "", "", "no PEM certificates found"},
+		{"", certFile, "", "both a certificate and a key file are required"},
+		{"", certFile, empty, "error loading the client certificate"},
+	}
+
+	for _, test := range tests {
+		_, err := LoadTLSConfig(test.caFile, test.certFile, test.keyFile, false)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("LoadTLSConfig(): expected an error containing %q, got %v", test.expected, err)
+		}
+	}
+}
+
+func TestParseUsesProxy(t *testing.T) {
+	var requested string
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		fmt.Fprint(w, `<title>Proxied</title>`)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	p := NewParser("http", "internal.test.com")
+	p.SetFetchOptions(FetchOptions{Proxy: proxyURL})
+
+	page, err := p.parse(context.TODO(), "http://internal.test.com/docs")
+	if err != nil {
+		t.Errorf("parse(): expected no error returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if requested != "http://internal.test.com/docs" || page.Title != "Proxied" {
+		t.Errorf("parse(): expected the page to be fetched through the proxy, got request %q and title %q", requested, page.Title)
+	}
+}
+
+func TestCrawlReusesConnections(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<a href="/foo">foo</a><a href="/bar">bar</a>`)
+	}))
+	defer ts.Close()
+
+	var tests = []struct {
+		keepAlive time.Duration
+		expected  ConnStats
+	}{
+		{0, ConnStats{Opened: 1, Reused: 2}},
+		{-1, ConnStats{Opened: 3, Reused: 0}},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(ts.URL)
+
+		m := NewMetrics()
+
+		c := NewCrawler(u, 0)
+		c.SetFetchOptions(FetchOptions{KeepAlive: test.keepAlive})
+		c.SetMetrics(m)
+		c.Crawl(context.TODO())
+
+		actual := c.Stats().Connections
+		if actual != test.expected {
+			t.Errorf("Stats(): expected connections %+v with keep-alive %s, got %+v", test.expected, test.keepAlive, actual)
+		}
+
+		var buffer strings.Builder
+		m.write(&buffer)
+
+		line := fmt.Sprintf(`crawler_connections_total{reused="false"} %d`, test.expected.Opened)
+		if !strings.Contains(buffer.String(), line+"\n") {
+			t.Errorf("Metrics: expected %s, got:\n%s", line, buffer.String())
+		}
+	}
+}
+
+func TestConnStatsReuseRate(t *testing.T) {
+	var tests = []struct {
+		stats    ConnStats
+		expected float64
+	}{
+		{ConnStats{}, 0},
+		{ConnStats{Opened: 1, Reused: 3}, 0.75},
+		{ConnStats{Opened: 2}, 0},
+	}
+
+	for _, test := range tests {
+		if actual := test.stats.ReuseRate(); actual != test.expected {
+			t.Errorf("ReuseRate(): expected %v for %+v, got %v", test.expected, test.stats, actual)
+		}
+	}
+}
+
+func TestParsePrefersHTTP2(t *testing.T) {
+	var proto int
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.ProtoMajor
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	var tests = []struct {
+		disable  bool
+		expected int
+	}{
+		{false, 2},
+		{true, 1},
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(ts.URL)
+
+		p := NewParser(u.Scheme, u.Host)
+		p.SetFetchOptions(FetchOptions{TLS: &tls.Config{InsecureSkipVerify: true}, DisableHTTP2: test.disable})
+
+		_, err := p.parse(context.TODO(), ts.URL)
+		if err != nil {
+			t.Errorf("parse(): expected no error returned, got %s", err.Error())
+		}
+
+		if proto != test.expected {
+			t.Errorf("parse(): expected HTTP/%d with HTTP/2 disabled %t, got HTTP/%d", test.expected, test.disable, proto)
+		}
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	transport := newTransport(FetchOptions{})
+	if transport.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost || transport.IdleConnTimeout != DefaultKeepAlive ||
+		transport.TLSHandshakeTimeout != DefaultTLSHandshakeTimeout || transport.DisableKeepAlives || !transport.ForceAttemptHTTP2 {
+		t.Errorf("newTransport(): expected the default settings, got %+v", transport)
+	}
+
+	transport = newTransport(FetchOptions{MaxIdleConnsPerHost: 4, KeepAlive: time.Minute, TLSHandshakeTimeout: time.Second})
+	if transport.MaxIdleConnsPerHost != 4 || transport.IdleConnTimeout != time.Minute || transport.TLSHandshakeTimeout != time.Second {
+		t.Errorf("newTransport(): expected the given settings, got %+v", transport)
+	}
+}
+
+func TestParseResolvesOverriddenHosts(t *testing.T) {
+	var host string
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		fmt.Fprint(w, `<a href="/foo">foo</a>`)
+	})
+
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "crawler-unix")
+	if err != nil {
+		t.Fatalf("failed to create a temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "app.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %s", socket, err.Error())
+	}
+
+	unix := httptest.NewUnstartedServer(handler)
+	unix.Listener = listener
+	unix.Start()
+	defer unix.Close()
+
+	addr := ts.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(addr)
+
+	var tests = []struct {
+		resolve map[string]string
+	}{
+		{map[string]string{"docs.test.com:" + port: addr}},
+		{map[string]string{"docs.test.com": "127.0.0.1"}},
+		{map[string]string{"docs.test.com": addr, "docs.test.com:1": "127.0.0.1:1"}},
+		{map[string]string{"docs.test.com:" + port: "unix://" + socket}},
+	}
+
+	for _, test := range tests {
+		host = ""
+
+		p := NewParser("http", "docs.test.com:"+port)
+		p.SetFetchOptions(FetchOptions{Resolve: test.resolve})
+
+		page, err := p.parse(context.TODO(), "http://docs.test.com:"+port)
+		if err != nil {
+			t.Errorf("parse(): expected no error returned with overrides %v, got %s", test.resolve, err.Error())
+			continue
+		}
+
+		expected := "http://docs.test.com:" + port + "/foo"
+		if host != "docs.test.com:"+port || len(page.Links) != 1 || page.Links[0] != expected {
+			t.Errorf("parse(): expected the real host name to be kept with overrides %v, got host %q and links %v", test.resolve, host, page.Links)
+		}
+	}
+}
+
+func TestParseUsesCustomDialer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	var dialed []string
+
+	dial := func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		dialed = append(dialed, network+" "+addr)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+
+	p := NewParser("http", "docs.test.com")
+	p.SetFetchOptions(FetchOptions{Dial: dial, Resolve: map[string]string{"docs.test.com": ts.Listener.Addr().String()}})
+
+	_, err := p.parse(context.TODO(), "http://docs.test.com")
+	if err != nil {
+		t.Errorf("parse(): expected no error returned, got %s", err.Error())
+	}
+
+	expected := []string{"tcp " + ts.Listener.Addr().String()}
+	if fmt.Sprint(dialed) != fmt.Sprint(expected) {
+		t.Errorf("parse(): expected the custom dialer to connect to %v, got %v", expected, dialed)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	overrides := map[string]string{
+		"test.com:443": "10.0.0.1",
+		"test.com":     "10.0.0.2:8080",
+		"api.test.com": "unix:///run/api.sock",
+		"v6.test.com":  "::1",
+	}
+
+	var tests = []struct {
+		addr     string
+		expected string
+	}{
+		{"test.com:443", "tcp 10.0.0.1:443"},
+		{"test.com:80", "tcp 10.0.0.2:8080"},
+		{"api.test.com:443", "unix /run/api.sock"},
+		{"v6.test.com:80", "tcp [::1]:80"},
+		{"other.com:80", "tcp other.com:80"},
+	}
+
+	for _, test := range tests {
+		network, addr := resolve(overrides, "tcp", test.addr)
+		if actual := network + " " + addr; actual != test.expected {
+			t.Errorf("resolve(%s): expected %s, got %s", test.addr, test.expected, actual)
+		}
+	}
+}
+
+// writeClientCertificate writes a self-signed client certificate with the given common name and its key to the given
+// directory, returning their paths.
+func writeClientCertificate(t *testing.T, dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate a key: %s", err.Error())
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create a certificate: %s", err.Error())
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal the key: %s", err.Error())
+	}
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0644)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+
+	return certFile, keyFile
+}
@@ -0,0 +1,169 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type treeNode struct {
+	name     string
+	page     Node
+	isPage   bool
+	children map[string]*treeNode
+}
+
+// Tree renders the given sitemap as a tree of pages grouped by URL path segments, similar to the output of `tree`.
+// Every branch shows the number of pages it contains, and the output is sorted alphabetically.
+// Only the pages which were crawled are included. If annotate is true, every page is annotated with its status code and title,
+// and resources which aren't HTML with their content type and size.
+func Tree(s *Sitemap, annotate bool) (string, error) {
+	roots := make(map[string]*treeNode)
+
+	for _, page := range s.Pages() {
+		u, err := url.Parse(string(page.URL))
+		if err != nil {
+			return "", fmt.Errorf("error parsing the page URL %s: %s", page.URL, err.Error())
+		}
+
+		rootName := u.Scheme + "://" + u.Host
+		if _, ok := roots[rootName]; !ok {
+			roots[rootName] = &treeNode{name: rootName, children: make(map[string]*treeNode)}
+		}
+
+		node := roots[rootName]
+		for _, segment := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+			if segment == "" {
+				continue
+			}
+
+			child, ok := node.children[segment]
+			if !ok {
+				child = &treeNode{name: segment, children: make(map[string]*treeNode)}
+				node.children[segment] = child
+			}
+			node = child
+		}
+
+		node.isPage = true
+		node.page = page
+	}
+
+	var buffer bytes.Buffer
+
+	for _, name := range sortedChildNames(roots) {
+		root := roots[name]
+
+		_, err := buffer.WriteString(treeLine(root, annotate) + "\n")
+		if err != nil {
+			return "", fmt.Errorf("error writing the tree: %s", err.Error())
+		}
+
+		err = writeTreeChildren(&buffer, root, annotate, "")
+		if err != nil {
+			return "", fmt.Errorf("error writing the tree: %s", err.Error())
+		}
+	}
+
+	return buffer.String(), nil
+}
+
+func writeTreeChildren(buffer *bytes.Buffer, node *treeNode, annotate bool, prefix string) error {
+	names := sortedChildNames(node.children)
+
+	for i, name := range names {
+		child := node.children[name]
+
+		branch, indent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		_, err := buffer.WriteString(prefix + branch + treeLine(child, annotate) + "\n")
+		if err != nil {
+			return err
+		}
+
+		err = writeTreeChildren(buffer, child, annotate, prefix+indent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// treeLine returns the text for a single node: its name, the number of pages under it (if it has children)
+// and the page annotation (if the node is a page and annotations are enabled).
+func treeLine(node *treeNode, annotate bool) string {
+	line := node.name
+
+	if len(node.children) > 0 {
+		count := node.count()
+		if count == 1 {
+			line += " (1 page)"
+		} else {
+			line += fmt.Sprintf(" (%d pages)", count)
+		}
+	}
+
+	if node.isPage && annotate {
+		if status := statusText(node.page); status != "" {
+			line += " [" + status + "]"
+		}
+
+		if node.page.Title != "" {
+			line += " " + node.page.Title
+		}
+
+		if node.page.ContentType != "" && !isHTML(node.page.ContentType) {
+			line += fmt.Sprintf(" (%s, %s)", node.page.ContentType, formatSize(node.page.Size))
+		}
+	}
+
+	return line
+}
+
+// formatSize returns the given number of bytes in a human readable form, e.g. 1.5 MB.
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	size := float64(bytes) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if size < unit || suffix == "GB" {
+			return fmt.Sprintf("%.1f %s", size, suffix)
+		}
+		size /= unit
+	}
+
+	return ""
+}
+
+func (n *treeNode) count() int {
+	count := 0
+	if n.isPage {
+		count++
+	}
+
+	for _, child := range n.children {
+		count += child.count()
+	}
+
+	return count
+}
+
+func sortedChildNames(children map[string]*treeNode) []string {
+	var names []string
+	for name := range children {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
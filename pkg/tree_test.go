@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	s := NewSitemap()
+	for _, page := range []string{
+		"https://test.com",
+		"https://test.com/foo",
+		"https://test.com/foo/bar",
+		"https://test.com/foo/baz/qux",
+		"https://test.com/about",
+	} {
+		s.AddPage(Page{Addr: CanonicalURL(page)})
+	}
+
+	actual, err := Tree(s, false)
+	if err != nil {
+		t.Errorf("Tree(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expected := `https://test.com (5 pages)
+├── about
+└── foo (3 pages)
+    ├── bar
+    └── baz (1 page)
+        └── qux
+`
+
+	if actual != expected {
+		t.Errorf("Tree(): expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestTreeWithAnnotations(t *testing.T) {
+	actual, err := Tree(getTestSitemap(), true)
+	if err != nil {
+		t.Errorf("Tree(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	expected := `https://test.com (4 pages) [200] Test
+├── bar [200]
+├── baz [200]
+└── foo [404] Foo & friends
+`
+
+	if actual != expected {
+		t.Errorf("Tree(): expected\n%s\ngot\n%s", expected, actual)
+	}
+}
+
+func TestTreeAnnotatesResources(t *testing.T) {
+	s := getTestSitemap()
+	s.AddPage(Page{Addr: "https://test.com/guide.pdf", Status: 200, Depth: 1, ContentType: "application/pdf", Size: 1536 * 1024})
+	s.AddEdge(Edge{From: "https://test.com", To: "https://test.com/guide.pdf"})
+
+	actual, err := Tree(s, true)
+	if err != nil {
+		t.Errorf("Tree(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	if !strings.Contains(actual, "guide.pdf [200] (application/pdf, 1.5 MB)\n") {
+		t.Errorf("Tree(): expected the PDF to be annotated with its type and size, got\n%s", actual)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	var tests = []struct {
+		bytes    int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{10 << 20, "10.0 MB"},
+		{3 << 40, "3072.0 GB"},
+	}
+
+	for _, test := range tests {
+		if actual := formatSize(test.bytes); actual != test.expected {
+			t.Errorf("formatSize(%d): expected %q, got %q", test.bytes, test.expected, actual)
+		}
+	}
+}
+
+func TestTreeIsDeterministic(t *testing.T) {
+	first, err := Tree(getTestSitemap(), false)
+	if err != nil {
+		t.Errorf("Tree(): expected no errors returned, got %s", err.Error())
+		t.FailNow()
+	}
+
+	for i := 0; i < 10; i++ {
+		actual, _ := Tree(getTestSitemap(), false)
+		if actual != first {
+			t.Errorf("Tree(): expected the same output every time, got\n%s\nand\n%s", first, actual)
+			t.FailNow()
+		}
+	}
+}